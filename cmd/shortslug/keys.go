@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/auth"
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+)
+
+const keysUsage = `usage:
+  shortslug keys create -name NAME -scopes links:write,links:read,analytics:read,admin
+  shortslug keys list
+  shortslug keys revoke ID`
+
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+
+	fs := flag.NewFlagSet("keys "+args[0], flag.ExitOnError)
+	dbPath := fs.String("db", envOrDefault("DATABASE_PATH", "shortslug.db"), "path to sqlite database file")
+	dbURL := fs.String("database-url", envOrDefault("DATABASE_URL", ""), "postgres connection URL; overrides -db")
+
+	switch args[0] {
+	case "create":
+		name := fs.String("name", "", "label for the key, e.g. the service using it")
+		rawScopes := fs.String("scopes", "", "comma-separated scopes")
+		_ = fs.Parse(args[1:])
+		if *name == "" {
+			return errors.New("-name is required")
+		}
+		scopes, err := auth.ParseScopes(*rawScopes)
+		if err != nil {
+			return err
+		}
+		return withStore(*dbPath, *dbURL, func(ctx context.Context, s store.Store) error {
+			return createKey(ctx, s, *name, scopes)
+		})
+	case "list":
+		_ = fs.Parse(args[1:])
+		return withStore(*dbPath, *dbURL, listKeys)
+	case "revoke":
+		_ = fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			return errors.New(keysUsage)
+		}
+		id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid key id %q", fs.Arg(0))
+		}
+		return withStore(*dbPath, *dbURL, func(ctx context.Context, s store.Store) error {
+			ok, err := s.RevokeAPIKey(ctx, id)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("no active key with id %d", id)
+			}
+			fmt.Printf("revoked key %d\n", id)
+			return nil
+		})
+	default:
+		return errors.New(keysUsage)
+	}
+}
+
+func withStore(dbPath, dbURL string, fn func(context.Context, store.Store) error) error {
+	s, err := openStore(dbPath, dbURL)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer s.Close()
+	return fn(context.Background(), s)
+}
+
+func createKey(ctx context.Context, s store.Store, name string, scopes []string) error {
+	plaintext, prefix, hash, err := auth.NewKey()
+	if err != nil {
+		return err
+	}
+	id, err := s.CreateAPIKey(ctx, store.APIKey{Name: name, Prefix: prefix, Hash: hash, Scopes: scopes})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created key %d (%s) with scopes %s\n", id, name, strings.Join(scopes, ","))
+	fmt.Printf("%s\n", plaintext)
+	fmt.Fprintln(os.Stderr, "store this key now; it cannot be shown again")
+	return nil
+}
+
+func listKeys(ctx context.Context, s store.Store) error {
+	keys, err := s.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tSCOPES\tCREATED\tREVOKED")
+	for _, k := range keys {
+		revoked := "-"
+		if k.RevokedAt != 0 {
+			revoked = time.Unix(k.RevokedAt, 0).UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, strings.Join(k.Scopes, ","),
+			time.Unix(k.CreatedAt, 0).UTC().Format(time.RFC3339), revoked)
+	}
+	return tw.Flush()
+}
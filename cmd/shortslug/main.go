@@ -2,39 +2,74 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/StealthBadger747/ShortSlug/internal/bot"
+	"github.com/StealthBadger747/ShortSlug/internal/metrics"
+	"github.com/StealthBadger747/ShortSlug/internal/ratelimit"
 	"github.com/StealthBadger747/ShortSlug/internal/server"
-	"github.com/StealthBadger747/ShortSlug/internal/store/sqlite"
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/store/memory"
+	"github.com/StealthBadger747/ShortSlug/internal/store/postgres"
+	"github.com/StealthBadger747/ShortSlug/internal/threatlist"
+	"github.com/StealthBadger747/ShortSlug/internal/urlcheck"
+	"github.com/StealthBadger747/ShortSlug/internal/webhook"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		if err := runKeys(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "keys: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var (
 		defaultPort     = envOrDefault("SERVER_PORT", "8080")
+		defaultMetrics  = envOrDefault("METRICS_ADDR", ":9090")
 		defaultFrontend = envOrDefault("FRONTEND_DIR", "")
 		defaultDB       = envOrDefault("DATABASE_PATH", "")
+		defaultDBURL    = envOrDefault("DATABASE_URL", "")
+		defaultLogLevel = envOrDefault("LOG_LEVEL", "info")
+		defaultLogFmt   = envOrDefault("LOG_FORMAT", "json")
 	)
 
 	port := flag.String("port", defaultPort, "server port")
+	metricsAddr := flag.String("metrics-addr", defaultMetrics, "address to serve Prometheus metrics on, or off; keep it private")
 	frontendDir := flag.String("frontend", defaultFrontend, "path to frontend assets")
-	dbPath := flag.String("db", defaultDB, "path to sqlite database file")
+	dbPath := flag.String("db", defaultDB, "path to sqlite database file, or :memory: for a non-persistent store")
+	dbURL := flag.String("database-url", defaultDBURL, "postgres connection URL; overrides -db")
+	logLevel := flag.String("log-level", defaultLogLevel, "minimum log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", defaultLogFmt, "log output format: json or text")
 	flag.Parse()
 
+	logger, err := newLogger(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid logging configuration: %v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
 	if *frontendDir == "" {
 		if dirExists("static") {
 			*frontendDir = "static"
 		} else {
-			log.Fatalf("frontend directory not set; use FRONTEND_DIR or -frontend")
+			fatal("frontend directory not set; use FRONTEND_DIR or -frontend")
 		}
 	}
 
@@ -44,52 +79,360 @@ func main() {
 
 	absFrontend, err := filepath.Abs(*frontendDir)
 	if err != nil {
-		log.Fatalf("failed to resolve frontend directory: %v", err)
+		fatal("failed to resolve frontend directory", "error", err)
 	}
 
-	store, err := sqlite.Open(*dbPath)
+	store, err := openStore(*dbPath, *dbURL)
 	if err != nil {
-		log.Fatalf("failed to open database: %v", err)
+		fatal("failed to open database", "error", err)
 	}
 	defer store.Close()
 
-	capVerifier := &bot.CapVerifier{
-		SiteVerifyURL: envOrDefault("CAP_SITEVERIFY_URL", ""),
-		Secret:        envOrDefault("CAP_SECRET", ""),
+	verifier, err := botVerifier()
+	if err != nil {
+		fatal("invalid bot verification settings", "error", err)
 	}
-	capAPIEndpoint := envOrDefault("CAP_API_ENDPOINT", "")
 	publicBaseURL := envOrDefault("PUBLIC_BASE_URL", "")
 	password := envOrDefault("SHORTEN_PASSWORD", "")
 	brandName := envOrDefault("BRAND_NAME", "ShortSlug")
 	analyticsPassword := envOrDefault("ANALYTICS_PASSWORD", "")
+	adminPassword := envOrDefault("ADMIN_PASSWORD", "")
+	redirectStatus, err := parseRedirectStatus(envOrDefault("DEFAULT_REDIRECT_STATUS", "301"))
+	if err != nil {
+		fatal("invalid DEFAULT_REDIRECT_STATUS", "error", err)
+	}
+
+	checker, err := urlChecker()
+	if err != nil {
+		fatal("invalid destination URL settings", "error", err)
+	}
+
+	threats, threatAction, err := threatList()
+	if err != nil {
+		fatal("invalid threat list settings", "error", err)
+	}
+
+	limits, err := rateLimits()
+	if err != nil {
+		fatal("invalid rate limit", "error", err)
+	}
+
+	readyChecksBot, err := strconv.ParseBool(envOrDefault("READYZ_CHECK_BOT", "true"))
+	if err != nil {
+		fatal("invalid READYZ_CHECK_BOT; use true or false")
+	}
+
+	reportThreshold, err := strconv.Atoi(envOrDefault("REPORT_THRESHOLD", strconv.Itoa(server.DefaultReportThreshold)))
+	if err != nil || reportThreshold < 0 {
+		fatal("invalid REPORT_THRESHOLD; use a whole number, or 0 to never quarantine")
+	}
 
+	appMetrics := metrics.New()
+	if sizer, ok := store.(metrics.Sizer); ok {
+		appMetrics.RegisterDBSize(sizer)
+	}
+	store = metrics.InstrumentStore(store, appMetrics)
+	if verifier != nil && verifier.Enabled() {
+		appMetrics.RegisterBotProvider(verifier)
+	}
+
+	webhooks := webhook.New(store)
+
+	opts := []server.Option{
+		server.WithAdminPassword(adminPassword),
+		server.WithDefaultRedirectStatus(redirectStatus),
+		server.WithWebhooks(webhooks),
+		server.WithMetrics(appMetrics),
+		server.WithLogger(logger),
+		server.WithRateLimits(limits),
+		server.WithURLChecker(checker),
+		server.WithThreatList(threats, threatAction),
+		server.WithReportThreshold(reportThreshold),
+		server.WithBotReadinessCheck(readyChecksBot),
+	}
+	if raw := envOrDefault("TRUSTED_PROXIES", ""); raw != "" {
+		proxies, err := server.ParseTrustedProxies(raw)
+		if err != nil {
+			fatal("invalid TRUSTED_PROXIES", "error", err)
+		}
+		opts = append(opts, server.WithTrustedProxies(proxies))
+	}
+	handler := server.New(absFrontend, store, verifier, publicBaseURL, password, brandName, analyticsPassword, opts...)
+
+	// Request contexts derive from baseCtx so handlers still running when
+	// the shutdown grace period ends have their store queries cancelled.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	const writeTimeout = 10 * time.Second
 	srv := &http.Server{
 		Addr:              ":" + *port,
-		Handler:           server.New(absFrontend, store, capVerifier, capAPIEndpoint, publicBaseURL, password, brandName, analyticsPassword),
+		Handler:           withRequestTimeout(handler, writeTimeout),
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       10 * time.Second,
-		WriteTimeout:      10 * time.Second,
+		WriteTimeout:      writeTimeout,
 		IdleTimeout:       60 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
 	}
 
 	go func() {
-		log.Printf("listening on %s", srv.Addr)
+		slog.Info("listening", "addr", srv.Addr)
 		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("server error: %v", err)
+			fatal("server error", "error", err)
 		}
 	}()
 
+	// Metrics get their own listener so they can be scraped without being
+	// reachable through the ingress.
+	var metricsSrv *http.Server
+	if *metricsAddr != "off" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", appMetrics.Handler())
+		metricsSrv = &http.Server{
+			Addr:              *metricsAddr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      writeTimeout,
+		}
+		go func() {
+			slog.Info("serving metrics", "addr", metricsSrv.Addr)
+			if err := metricsSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				fatal("metrics server error", "error", err)
+			}
+		}()
+	}
+
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-	<-sigCh
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigCh {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if threats == nil {
+			continue
+		}
+		if err := threats.Reload(); err != nil {
+			slog.Error("failed to reload threat lists", "error", err)
+			continue
+		}
+		slog.Info("reloaded threat lists", "entries", threats.Len())
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		fmt.Fprintf(os.Stderr, "shutdown error: %v\n", err)
+		slog.Error("shutdown error", "error", err)
+	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			slog.Error("metrics shutdown error", "error", err)
+		}
+	}
+	cancelRequests()
+	if err := webhooks.Close(ctx); err != nil {
+		slog.Error("webhook shutdown error", "error", err)
+	}
+}
+
+// withRequestTimeout bounds each request's context, and so its database
+// work, by the server's write timeout; the response can't be sent after
+// that anyway.
+func withRequestTimeout(h http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// openStore uses Postgres when databaseURL is set, the in-memory store when
+// dbPath is ":memory:", and the SQLite file at dbPath otherwise.
+func openStore(dbPath, databaseURL string) (store.Store, error) {
+	if databaseURL != "" {
+		return postgres.Open(databaseURL)
+	}
+	if dbPath == ":memory:" {
+		return memory.New(), nil
+	}
+	return openSQLite(dbPath)
+}
+
+func parseRedirectStatus(raw string) (int, error) {
+	status, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, err
+	}
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return status, nil
+	default:
+		return 0, fmt.Errorf("%d is not one of 301, 302, 307, 308", status)
 	}
 }
 
+// botVerifier picks the bot check named by BOT_PROVIDER: cap (the default),
+// turnstile, hcaptcha, recaptcha, pow or none. Each reads its own variables and
+// stays disabled until they are set.
+func botVerifier() (bot.Verifier, error) {
+	switch provider := strings.ToLower(envOrDefault("BOT_PROVIDER", "cap")); provider {
+	case "cap":
+		return &bot.CapVerifier{
+			SiteVerifyURL: envOrDefault("CAP_SITEVERIFY_URL", ""),
+			Secret:        envOrDefault("CAP_SECRET", ""),
+			APIEndpoint:   envOrDefault("CAP_API_ENDPOINT", ""),
+		}, nil
+	case "turnstile":
+		return &bot.TurnstileVerifier{
+			SiteKey: envOrDefault("TURNSTILE_SITE_KEY", ""),
+			Secret:  envOrDefault("TURNSTILE_SECRET", ""),
+		}, nil
+	case "hcaptcha":
+		return &bot.HCaptchaVerifier{
+			SiteKey: envOrDefault("HCAPTCHA_SITE_KEY", ""),
+			Secret:  envOrDefault("HCAPTCHA_SECRET", ""),
+		}, nil
+	case "recaptcha":
+		minScore, err := strconv.ParseFloat(envOrDefault("RECAPTCHA_MIN_SCORE", "0.5"), 64)
+		if err != nil || minScore <= 0 || minScore > 1 {
+			return nil, fmt.Errorf("RECAPTCHA_MIN_SCORE must be a number in (0, 1]")
+		}
+		return &bot.RecaptchaVerifier{
+			SiteKey:  envOrDefault("RECAPTCHA_SITE_KEY", ""),
+			Secret:   envOrDefault("RECAPTCHA_SECRET", ""),
+			MinScore: minScore,
+		}, nil
+	case "pow":
+		difficulty, err := strconv.Atoi(envOrDefault("POW_DIFFICULTY", strconv.Itoa(bot.DefaultPoWDifficulty)))
+		if err != nil || difficulty < 1 || difficulty > 32 {
+			return nil, fmt.Errorf("POW_DIFFICULTY must be between 1 and 32")
+		}
+		key := []byte(envOrDefault("POW_SECRET", ""))
+		if len(key) == 0 {
+			// Challenges only need to outlive this process, but replicas
+			// can't verify each other's without a shared secret.
+			key = make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, err
+			}
+			slog.Warn("POW_SECRET not set; using a random key, so challenges only verify on this replica")
+		}
+		return bot.NewPoWVerifier(key, difficulty), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown BOT_PROVIDER %q", provider)
+	}
+}
+
+// urlChecker builds the destination checks from URL_DENYLIST_FILE,
+// URL_ALLOWLIST_FILE and ALLOW_PRIVATE_DESTINATIONS.
+func urlChecker() (*urlcheck.Checker, error) {
+	var opts []urlcheck.Option
+	if path := envOrDefault("URL_DENYLIST_FILE", ""); path != "" {
+		domains, err := urlcheck.LoadList(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, urlcheck.WithDenyList(domains))
+	}
+	if path := envOrDefault("URL_ALLOWLIST_FILE", ""); path != "" {
+		domains, err := urlcheck.LoadList(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, urlcheck.WithAllowList(domains))
+	}
+	if allow, _ := strconv.ParseBool(envOrDefault("ALLOW_PRIVATE_DESTINATIONS", "false")); allow {
+		opts = append(opts, urlcheck.AllowPrivateHosts())
+	} else {
+		opts = append(opts, urlcheck.WithResolver(net.DefaultResolver))
+	}
+	return urlcheck.New(opts...), nil
+}
+
+// threatList loads the comma-separated THREAT_LIST_FILES. THREAT_LIST_ACTION
+// decides whether following a link to a listed destination shows a warning
+// (the default) or is blocked.
+func threatList() (*threatlist.List, server.ThreatAction, error) {
+	var action server.ThreatAction
+	switch raw := envOrDefault("THREAT_LIST_ACTION", "warn"); raw {
+	case "block":
+		action = server.ThreatBlock
+	case "warn":
+		action = server.ThreatWarn
+	default:
+		return nil, 0, fmt.Errorf("unknown THREAT_LIST_ACTION %q", raw)
+	}
+
+	var paths []string
+	for path := range strings.SplitSeq(envOrDefault("THREAT_LIST_FILES", ""), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, action, nil
+	}
+	list, err := threatlist.Load(paths...)
+	if err != nil {
+		return nil, 0, err
+	}
+	slog.Info("loaded threat lists", "files", len(paths), "entries", list.Len())
+	return list, action, nil
+}
+
+// rateLimits reads the RATE_LIMIT_* variables. Each takes a rate such as
+// "30/m", or "off".
+func rateLimits() (server.RateLimits, error) {
+	parse := func(key, fallback string) (*ratelimit.Limiter, error) {
+		rate, err := ratelimit.ParseRate(envOrDefault(key, fallback))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		return ratelimit.New(rate), nil
+	}
+	var limits server.RateLimits
+	var err error
+	if limits.Shorten, err = parse("RATE_LIMIT_SHORTEN", "20/m"); err != nil {
+		return limits, err
+	}
+	if limits.Redirect, err = parse("RATE_LIMIT_REDIRECT", "300/m"); err != nil {
+		return limits, err
+	}
+	if limits.Analytics, err = parse("RATE_LIMIT_ANALYTICS", "60/m"); err != nil {
+		return limits, err
+	}
+	if limits.Report, err = parse("RATE_LIMIT_REPORT", "10/h"); err != nil {
+		return limits, err
+	}
+	if limits.Challenge, err = parse("RATE_LIMIT_CHALLENGE", "30/m"); err != nil {
+		return limits, err
+	}
+	return limits, nil
+}
+
+// newLogger builds the process logger from LOG_LEVEL and LOG_FORMAT.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
 func envOrDefault(key, fallback string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
@@ -0,0 +1,12 @@
+//go:build cgo
+
+package main
+
+import (
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/store/sqlite"
+)
+
+func openSQLite(path string) (store.Store, error) {
+	return sqlite.Open(path)
+}
@@ -0,0 +1,15 @@
+//go:build !cgo
+
+package main
+
+import (
+	"errors"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+)
+
+// The SQLite driver needs cgo; builds without it can still use the
+// in-memory and Postgres stores.
+func openSQLite(path string) (store.Store, error) {
+	return nil, errors.New("sqlite support requires a cgo build; use DATABASE_PATH=:memory: or DATABASE_URL")
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/StealthBadger747/ShortSlug/internal/util"
+)
+
+const (
+	ScopeLinksWrite    = "links:write"
+	ScopeLinksRead     = "links:read"
+	ScopeAnalyticsRead = "analytics:read"
+	// ScopeAdmin grants every other scope.
+	ScopeAdmin = "admin"
+)
+
+const (
+	keyPrefix    = "ss_"
+	keySecretLen = 40
+	displayLen   = 8
+)
+
+var scopes = map[string]struct{}{
+	ScopeLinksWrite:    {},
+	ScopeLinksRead:     {},
+	ScopeAnalyticsRead: {},
+	ScopeAdmin:         {},
+}
+
+// NewKey mints a random API key. Only the hash is meant to be stored; the
+// plaintext is shown to the operator once. prefix identifies the key in
+// listings without revealing it.
+func NewKey() (plaintext, prefix, hash string, err error) {
+	secret, err := util.RandomCode(keySecretLen)
+	if err != nil {
+		return "", "", "", err
+	}
+	plaintext = keyPrefix + secret
+	return plaintext, plaintext[:len(keyPrefix)+displayLen], HashKey(plaintext), nil
+}
+
+// HashKey returns the lookup hash for a key. Keys carry enough entropy that
+// a fast hash is sufficient.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseScopes splits a comma- or space-separated scope list and rejects
+// unknown names.
+func ParseScopes(raw string) ([]string, error) {
+	fields := strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	seen := make(map[string]struct{}, len(fields))
+	result := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if _, ok := scopes[f]; !ok {
+			return nil, fmt.Errorf("unknown scope %q", f)
+		}
+		if _, dup := seen[f]; dup {
+			continue
+		}
+		seen[f] = struct{}{}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+func HasScope(granted []string, want string) bool {
+	for _, g := range granted {
+		if g == want || g == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
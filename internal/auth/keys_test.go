@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewKey(t *testing.T) {
+	key, prefix, hash, err := NewKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(key, prefix) || !strings.HasPrefix(prefix, "ss_") {
+		t.Fatalf("unexpected key %q with prefix %q", key, prefix)
+	}
+	if hash != HashKey(key) {
+		t.Fatalf("hash does not match key")
+	}
+}
+
+func TestParseScopesAndHasScope(t *testing.T) {
+	scopes, err := ParseScopes("links:write, analytics:read links:write")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(scopes) != 2 {
+		t.Fatalf("expected duplicates to be dropped, got %v", scopes)
+	}
+	if !HasScope(scopes, ScopeAnalyticsRead) || HasScope(scopes, ScopeLinksRead) {
+		t.Fatalf("unexpected scope checks for %v", scopes)
+	}
+	if !HasScope([]string{ScopeAdmin}, ScopeLinksRead) {
+		t.Fatalf("expected admin to grant every scope")
+	}
+	if _, err := ParseScopes("links:delete"); err == nil {
+		t.Fatalf("expected unknown scope to fail")
+	}
+}
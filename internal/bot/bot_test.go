@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// siteVerifyStub answers like a form-based siteverify endpoint, replying
+// with reply for the token "good" and a failure otherwise. It records the
+// last form it received.
+func siteVerifyStub(t *testing.T, reply map[string]any) (*httptest.Server, *url.Values) {
+	t.Helper()
+	var last url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		last = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("response") != "good" {
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": false, "error-codes": []string{"invalid-input-response"}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &last
+}
+
+func TestTurnstileVerifier(t *testing.T) {
+	srv, last := siteVerifyStub(t, map[string]any{"success": true})
+	v := &TurnstileVerifier{SiteKey: "site", Secret: "shh", SiteVerifyURL: srv.URL}
+
+	if err := v.Verify(t.Context(), "good", "203.0.113.9"); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if last.Get("secret") != "shh" || last.Get("remoteip") != "203.0.113.9" {
+		t.Fatalf("unexpected siteverify form: %v", *last)
+	}
+	if err := v.Verify(t.Context(), "bad", ""); err == nil {
+		t.Fatalf("expected a rejected token to fail")
+	}
+	if err := v.Verify(t.Context(), "", ""); err == nil {
+		t.Fatalf("expected a missing token to fail")
+	}
+	if err := v.Ping(t.Context()); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	w := v.Widget()
+	if w.TokenField != "cf-turnstile-response" || !strings.Contains(string(w.Markup), `data-sitekey="site"`) {
+		t.Fatalf("unexpected widget: %+v", w)
+	}
+}
+
+func TestHCaptchaVerifierSendsSiteKey(t *testing.T) {
+	srv, last := siteVerifyStub(t, map[string]any{"success": true})
+	v := &HCaptchaVerifier{SiteKey: "site", Secret: "shh", SiteVerifyURL: srv.URL}
+
+	if err := v.Verify(t.Context(), "good", ""); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if last.Get("sitekey") != "site" {
+		t.Fatalf("expected the site key to be sent, got %v", *last)
+	}
+}
+
+func TestRecaptchaVerifierScore(t *testing.T) {
+	cases := []struct {
+		name     string
+		reply    map[string]any
+		minScore float64
+		ok       bool
+	}{
+		{name: "above default", reply: map[string]any{"success": true, "score": 0.9, "action": RecaptchaAction}, ok: true},
+		{name: "below default", reply: map[string]any{"success": true, "score": 0.3, "action": RecaptchaAction}},
+		{name: "custom threshold", reply: map[string]any{"success": true, "score": 0.3, "action": RecaptchaAction}, minScore: 0.2, ok: true},
+		{name: "wrong action", reply: map[string]any{"success": true, "score": 0.9, "action": "login"}},
+	}
+	for _, tc := range cases {
+		srv, _ := siteVerifyStub(t, tc.reply)
+		v := &RecaptchaVerifier{SiteKey: "site", Secret: "shh", MinScore: tc.minScore, SiteVerifyURL: srv.URL}
+		if err := v.Verify(t.Context(), "good", ""); (err == nil) != tc.ok {
+			t.Fatalf("%s: expected ok=%v, got %v", tc.name, tc.ok, err)
+		}
+	}
+}
+
+func TestCapVerifier(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req capVerifyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		_ = json.NewEncoder(w).Encode(capVerifyResponse{Success: req.Secret == "shh" && req.Response == "good"})
+	}))
+	t.Cleanup(srv.Close)
+
+	v := &CapVerifier{SiteVerifyURL: srv.URL, Secret: "shh", APIEndpoint: "https://cap.example.com/api/"}
+	if err := v.Verify(t.Context(), "good", ""); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := v.Verify(t.Context(), "bad", ""); err == nil {
+		t.Fatalf("expected a rejected token to fail")
+	}
+	if got := v.Widget().CSP["connect-src"]; len(got) != 1 || got[0] != "https://cap.example.com" {
+		t.Fatalf("expected the Cap API origin in connect-src, got %v", got)
+	}
+}
+
+func TestDisabledVerifiersAcceptEverything(t *testing.T) {
+	for _, v := range []Verifier{(*CapVerifier)(nil), &TurnstileVerifier{}, &HCaptchaVerifier{}, &RecaptchaVerifier{}} {
+		if v.Enabled() {
+			t.Fatalf("%T: expected an unconfigured verifier to be disabled", v)
+		}
+		if err := v.Verify(t.Context(), "", ""); err != nil {
+			t.Fatalf("%T: expected a disabled verifier to accept, got %v", v, err)
+		}
+		if w := v.Widget(); w.Markup != "" || len(w.Scripts) != 0 {
+			t.Fatalf("%T: expected no widget, got %+v", v, w)
+		}
+	}
+}
@@ -6,16 +6,21 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
-	"time"
+	"net/url"
 )
 
 type CapVerifier struct {
 	SiteVerifyURL string
 	Secret        string
-	Client        *http.Client
+	// APIEndpoint is the Cap server the widget solves challenges against.
+	APIEndpoint string
+	Client      *http.Client
 }
 
+var _ Verifier = (*CapVerifier)(nil)
+
 func (v *CapVerifier) Enabled() bool {
 	return v != nil && v.SiteVerifyURL != "" && v.Secret != ""
 }
@@ -29,17 +34,35 @@ type capVerifyResponse struct {
 	Success bool `json:"success"`
 }
 
-func (v *CapVerifier) Verify(ctx context.Context, token string) error {
+func (v *CapVerifier) Ping(ctx context.Context) error {
 	if !v.Enabled() {
 		return nil
 	}
-	if token == "" {
-		return errors.New("missing cap token")
+	return pingEndpoint(ctx, v.Client, v.SiteVerifyURL)
+}
+
+func (v *CapVerifier) Widget() Widget {
+	if !v.Enabled() || v.APIEndpoint == "" {
+		return Widget{}
+	}
+	w := Widget{
+		Scripts:    []string{"https://unpkg.com/@tiagozip/cap@latest/cap.min.js"},
+		Markup:     template.HTML(`<cap-widget data-cap-api-endpoint="` + template.HTMLEscapeString(v.APIEndpoint) + `"></cap-widget>`),
+		TokenField: "cap-token",
+		CSP:        map[string][]string{"script-src": {"https://unpkg.com"}},
+	}
+	if u, err := url.Parse(v.APIEndpoint); err == nil && u.Scheme != "" && u.Host != "" {
+		w.CSP["connect-src"] = []string{u.Scheme + "://" + u.Host}
 	}
+	return w
+}
 
-	client := v.Client
-	if client == nil {
-		client = &http.Client{Timeout: 5 * time.Second}
+func (v *CapVerifier) Verify(ctx context.Context, token, _ string) error {
+	if !v.Enabled() {
+		return nil
+	}
+	if token == "" {
+		return errors.New("missing cap token")
 	}
 
 	payload, err := json.Marshal(capVerifyRequest{Secret: v.Secret, Response: token})
@@ -53,7 +76,7 @@ func (v *CapVerifier) Verify(ctx context.Context, token string) error {
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := client.Do(req)
+	resp, err := httpClient(v.Client).Do(req)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const hcaptchaSiteVerifyURL = "https://api.hcaptcha.com/siteverify"
+
+// HCaptchaVerifier checks hCaptcha tokens.
+type HCaptchaVerifier struct {
+	SiteKey string
+	Secret  string
+	// SiteVerifyURL overrides hCaptcha's endpoint.
+	SiteVerifyURL string
+	Client        *http.Client
+}
+
+var _ Verifier = (*HCaptchaVerifier)(nil)
+
+func (v *HCaptchaVerifier) Enabled() bool {
+	return v != nil && v.SiteKey != "" && v.Secret != ""
+}
+
+func (v *HCaptchaVerifier) endpoint() string {
+	if v.SiteVerifyURL != "" {
+		return v.SiteVerifyURL
+	}
+	return hcaptchaSiteVerifyURL
+}
+
+func (v *HCaptchaVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if !v.Enabled() {
+		return nil
+	}
+	if token == "" {
+		return errors.New("missing hcaptcha token")
+	}
+	form := verifyForm(v.Secret, token, remoteIP)
+	form.Set("sitekey", v.SiteKey)
+
+	var result siteVerifyResponse
+	if err := postSiteVerify(ctx, v.Client, v.endpoint(), form, &result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return fmt.Errorf("hcaptcha verification failed: %v", result.ErrorCodes)
+	}
+	return nil
+}
+
+func (v *HCaptchaVerifier) Ping(ctx context.Context) error {
+	if !v.Enabled() {
+		return nil
+	}
+	return pingEndpoint(ctx, v.Client, v.endpoint())
+}
+
+func (v *HCaptchaVerifier) Widget() Widget {
+	if !v.Enabled() {
+		return Widget{}
+	}
+	sources := []string{"https://hcaptcha.com", "https://*.hcaptcha.com"}
+	return Widget{
+		Scripts:    []string{"https://js.hcaptcha.com/1/api.js"},
+		Markup:     siteKeyDiv("h-captcha", v.SiteKey),
+		TokenField: "h-captcha-response",
+		CSP: map[string][]string{
+			"script-src":  sources,
+			"frame-src":   sources,
+			"style-src":   sources,
+			"connect-src": sources,
+		},
+	}
+}
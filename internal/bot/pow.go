@@ -0,0 +1,252 @@
+package bot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPoWDifficulty takes a browser around a second to solve.
+	DefaultPoWDifficulty = 16
+	// PoWChallengePath is where the server hands out challenges.
+	PoWChallengePath = "/api/challenge"
+
+	powChallengeTTL   = 5 * time.Minute
+	powMaxOutstanding = 100000
+	powMaxPerClient   = 1000
+)
+
+var (
+	// ErrTooManyChallenges is returned by Challenge while as many
+	// challenges as the verifier will remember are outstanding.
+	ErrTooManyChallenges = errors.New("too many outstanding proof-of-work challenges")
+	// ErrClientChallengeLimit is returned by Challenge while one client
+	// holds its share of the outstanding challenges.
+	ErrClientChallengeLimit = errors.New("too many outstanding proof-of-work challenges for this client")
+)
+
+// Challenge is a signed proof-of-work puzzle. The client must find a
+// counter such that SHA-256 of "<challenge>:<counter>" starts with
+// Difficulty zero bits, and submit that string as its token.
+type Challenge struct {
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+	ExpiresAt  int64  `json:"expires_at"`
+}
+
+// Challenger is implemented by verifiers that issue their own challenges
+// instead of relying on an external service. client identifies who asked,
+// so no single client can claim every challenge.
+type Challenger interface {
+	Challenge(client string) (Challenge, error)
+}
+
+// PoWVerifier is a self-contained bot check. Challenges are signed with an
+// HMAC key, so they need no storage until they are spent; spent challenges
+// are remembered until they expire so each can be used once. Replicas must
+// share the key, and a challenge spent on one replica is not known to the
+// others.
+//
+// Memory is bounded by refusing new challenges, not solutions: at most
+// maxOutstanding unexpired challenges are issued at a time, so a flood of
+// challenge requests can't stop clients holding one from getting through.
+// Each client may hold maxPerClient of them, so one client can't use up the
+// rest's budget either.
+type PoWVerifier struct {
+	key            []byte
+	difficulty     int
+	now            func() time.Time
+	maxOutstanding int
+	maxPerClient   int
+
+	mu    sync.Mutex
+	spent map[string]time.Time
+	// issued holds the outstanding challenges, oldest first, and perClient
+	// how many of them each client holds.
+	issued    []issuedChallenge
+	perClient map[string]int
+}
+
+type issuedChallenge struct {
+	expires int64
+	client  string
+}
+
+var (
+	_ Verifier   = (*PoWVerifier)(nil)
+	_ Challenger = (*PoWVerifier)(nil)
+)
+
+// NewPoWVerifier returns a verifier signing challenges with key. A
+// difficulty of zero uses DefaultPoWDifficulty.
+func NewPoWVerifier(key []byte, difficulty int) *PoWVerifier {
+	if difficulty <= 0 {
+		difficulty = DefaultPoWDifficulty
+	}
+	return &PoWVerifier{
+		key:            key,
+		difficulty:     difficulty,
+		now:            time.Now,
+		maxOutstanding: powMaxOutstanding,
+		maxPerClient:   powMaxPerClient,
+		spent:          make(map[string]time.Time),
+		perClient:      make(map[string]int),
+	}
+}
+
+func (v *PoWVerifier) Enabled() bool {
+	return v != nil && len(v.key) > 0
+}
+
+func (v *PoWVerifier) Challenge(client string) (Challenge, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return Challenge{}, err
+	}
+	now := v.now()
+	expires := now.Add(powChallengeTTL).Unix()
+	if err := v.issue(client, expires, now); err != nil {
+		return Challenge{}, err
+	}
+	body := fmt.Sprintf("%s.%d.%d", base64.RawURLEncoding.EncodeToString(nonce), expires, v.difficulty)
+	return Challenge{
+		Challenge:  body + "." + v.sign(body),
+		Difficulty: v.difficulty,
+		ExpiresAt:  expires,
+	}, nil
+}
+
+// issue reserves room for a challenge for client expiring at expires.
+func (v *PoWVerifier) issue(client string, expires int64, now time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	i := 0
+	for ; i < len(v.issued) && v.issued[i].expires <= now.Unix(); i++ {
+		c := v.issued[i].client
+		if v.perClient[c]--; v.perClient[c] <= 0 {
+			delete(v.perClient, c)
+		}
+	}
+	v.issued = v.issued[i:]
+	if len(v.issued) >= v.maxOutstanding {
+		return ErrTooManyChallenges
+	}
+	if v.perClient[client] >= v.maxPerClient {
+		return ErrClientChallengeLimit
+	}
+	v.issued = append(v.issued, issuedChallenge{expires: expires, client: client})
+	v.perClient[client]++
+	return nil
+}
+
+func (v *PoWVerifier) sign(body string) string {
+	mac := hmac.New(sha256.New, v.key)
+	mac.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (v *PoWVerifier) Verify(_ context.Context, token, _ string) error {
+	if !v.Enabled() {
+		return nil
+	}
+	if token == "" {
+		return errors.New("missing proof-of-work token")
+	}
+
+	challenge, counter, ok := strings.Cut(token, ":")
+	if !ok || counter == "" || len(counter) > 20 {
+		return errors.New("malformed proof-of-work token")
+	}
+	body, sig, ok := cutLast(challenge, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(v.sign(body))) {
+		return errors.New("proof-of-work challenge has a bad signature")
+	}
+	parts := strings.Split(body, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed proof-of-work challenge")
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return errors.New("malformed proof-of-work challenge")
+	}
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return errors.New("malformed proof-of-work challenge")
+	}
+
+	now := v.now()
+	if now.Unix() >= expires {
+		return errors.New("proof-of-work challenge expired")
+	}
+	if sum := sha256.Sum256([]byte(token)); leadingZeroBits(sum) < difficulty {
+		return errors.New("proof-of-work solution is wrong")
+	}
+	return v.spend(parts[0], time.Unix(expires, 0), now)
+}
+
+// spend records nonce as used, failing if it already was. A valid solution
+// is never refused for lack of room; issue already bounds how many can be
+// outstanding.
+func (v *PoWVerifier) spend(nonce string, expires, now time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, ok := v.spent[nonce]; ok {
+		return errors.New("proof-of-work challenge already used")
+	}
+	if len(v.spent) >= v.maxOutstanding {
+		for n, exp := range v.spent {
+			if !now.Before(exp) {
+				delete(v.spent, n)
+			}
+		}
+	}
+	v.spent[nonce] = expires
+	return nil
+}
+
+// Ping always succeeds; there is no external service to reach.
+func (v *PoWVerifier) Ping(context.Context) error {
+	return nil
+}
+
+func (v *PoWVerifier) Widget() Widget {
+	if !v.Enabled() {
+		return Widget{}
+	}
+	return Widget{
+		Scripts:    []string{"/pow.js"},
+		Markup:     template.HTML(`<input type="hidden" name="pow-token" data-pow-challenge="` + PoWChallengePath + `" />`),
+		TokenField: "pow-token",
+	}
+}
+
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"crypto/sha256"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func solvePoW(t *testing.T, c Challenge) string {
+	t.Helper()
+	for counter := 0; counter < 1<<24; counter++ {
+		token := c.Challenge + ":" + strconv.Itoa(counter)
+		if leadingZeroBits(sha256.Sum256([]byte(token))) >= c.Difficulty {
+			return token
+		}
+	}
+	t.Fatalf("no solution found for %q", c.Challenge)
+	return ""
+}
+
+func TestPoWVerifier(t *testing.T) {
+	v := NewPoWVerifier([]byte("test-key"), 8)
+	c, err := v.Challenge("198.51.100.0")
+	if err != nil {
+		t.Fatalf("challenge: %v", err)
+	}
+	if c.Difficulty != 8 {
+		t.Fatalf("expected difficulty 8, got %d", c.Difficulty)
+	}
+
+	token := solvePoW(t, c)
+	if err := v.Verify(t.Context(), token, ""); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := v.Verify(t.Context(), token, ""); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("expected a replayed token to fail, got %v", err)
+	}
+}
+
+func TestPoWVerifierRejects(t *testing.T) {
+	v := NewPoWVerifier([]byte("test-key"), 8)
+	c, err := v.Challenge("198.51.100.0")
+	if err != nil {
+		t.Fatalf("challenge: %v", err)
+	}
+	token := solvePoW(t, c)
+
+	easier := strings.Replace(c.Challenge, ".8.", ".0.", 1)
+	other := NewPoWVerifier([]byte("other-key"), 8)
+	cases := map[string]struct {
+		v     *PoWVerifier
+		token string
+	}{
+		"missing":         {v, ""},
+		"no counter":      {v, c.Challenge},
+		"lowered":         {v, easier + ":0"},
+		"wrong key":       {other, token},
+		"wrong solution":  {v, c.Challenge + ":not-a-solution-" + strconv.Itoa(len(token))},
+		"garbage":         {v, "a.b:1"},
+		"oversize number": {v, c.Challenge + ":" + strings.Repeat("9", 21)},
+	}
+	for name, tc := range cases {
+		// A wrong solution could pass by luck; skip the rare case.
+		if name == "wrong solution" && leadingZeroBits(sha256.Sum256([]byte(tc.token))) >= 8 {
+			continue
+		}
+		if err := tc.v.Verify(t.Context(), tc.token, ""); err == nil {
+			t.Fatalf("%s: expected verification to fail", name)
+		}
+	}
+
+	v.now = func() time.Time { return time.Now().Add(powChallengeTTL + time.Second) }
+	if err := v.Verify(t.Context(), token, ""); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expected an expired challenge to fail, got %v", err)
+	}
+}
+
+func TestPoWVerifierRefusesChallengesWhenFull(t *testing.T) {
+	v := NewPoWVerifier([]byte("test-key"), 8)
+	v.maxOutstanding = 3
+	v.maxPerClient = 2
+
+	var tokens []string
+	for i := 0; i < 2; i++ {
+		c, err := v.Challenge("198.51.100.0")
+		if err != nil {
+			t.Fatalf("challenge %d: %v", i+1, err)
+		}
+		tokens = append(tokens, solvePoW(t, c))
+	}
+	if _, err := v.Challenge("198.51.100.0"); !errors.Is(err, ErrClientChallengeLimit) {
+		t.Fatalf("expected a client's third challenge to be refused, got %v", err)
+	}
+	if _, err := v.Challenge("203.0.113.0"); err != nil {
+		t.Fatalf("expected another client to get a challenge, got %v", err)
+	}
+	if _, err := v.Challenge("192.0.2.0"); !errors.Is(err, ErrTooManyChallenges) {
+		t.Fatalf("expected challenges past the global limit to be refused, got %v", err)
+	}
+	for i, token := range tokens {
+		if err := v.Verify(t.Context(), token, ""); err != nil {
+			t.Fatalf("expected outstanding solution %d to verify, got %v", i+1, err)
+		}
+	}
+
+	v.now = func() time.Time { return time.Now().Add(powChallengeTTL + time.Second) }
+	if _, err := v.Challenge("198.51.100.0"); err != nil {
+		t.Fatalf("expected challenges once the old ones expired, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const turnstileSiteVerifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+
+// TurnstileVerifier checks Cloudflare Turnstile tokens.
+type TurnstileVerifier struct {
+	SiteKey string
+	Secret  string
+	// SiteVerifyURL overrides Cloudflare's endpoint.
+	SiteVerifyURL string
+	Client        *http.Client
+}
+
+var _ Verifier = (*TurnstileVerifier)(nil)
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (v *TurnstileVerifier) Enabled() bool {
+	return v != nil && v.SiteKey != "" && v.Secret != ""
+}
+
+func (v *TurnstileVerifier) endpoint() string {
+	if v.SiteVerifyURL != "" {
+		return v.SiteVerifyURL
+	}
+	return turnstileSiteVerifyURL
+}
+
+func (v *TurnstileVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if !v.Enabled() {
+		return nil
+	}
+	if token == "" {
+		return errors.New("missing turnstile token")
+	}
+	var result siteVerifyResponse
+	if err := postSiteVerify(ctx, v.Client, v.endpoint(), verifyForm(v.Secret, token, remoteIP), &result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return fmt.Errorf("turnstile verification failed: %v", result.ErrorCodes)
+	}
+	return nil
+}
+
+func (v *TurnstileVerifier) Ping(ctx context.Context) error {
+	if !v.Enabled() {
+		return nil
+	}
+	return pingEndpoint(ctx, v.Client, v.endpoint())
+}
+
+func (v *TurnstileVerifier) Widget() Widget {
+	if !v.Enabled() {
+		return Widget{}
+	}
+	const origin = "https://challenges.cloudflare.com"
+	return Widget{
+		Scripts:    []string{origin + "/turnstile/v0/api.js"},
+		Markup:     siteKeyDiv("cf-turnstile", v.SiteKey),
+		TokenField: "cf-turnstile-response",
+		CSP: map[string][]string{
+			"script-src": {origin},
+			"frame-src":  {origin},
+		},
+	}
+}
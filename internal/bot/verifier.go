@@ -0,0 +1,100 @@
+// Package bot verifies the challenge tokens that bot filtering widgets add
+// to the shorten form.
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Verifier checks challenge tokens for one provider.
+type Verifier interface {
+	// Enabled reports whether the verifier is configured. Disabled
+	// verifiers accept every request.
+	Enabled() bool
+	// Verify checks the token the widget submitted. remoteIP is passed on
+	// to providers that use it as a signal and may be empty.
+	Verify(ctx context.Context, token, remoteIP string) error
+	// Ping reports whether the provider's verification endpoint answers.
+	Ping(ctx context.Context) error
+	// Widget describes what the index page needs to render the challenge.
+	Widget() Widget
+}
+
+// Widget is the client side of a verifier.
+type Widget struct {
+	// Scripts are loaded with defer in the page head.
+	Scripts []string
+	// Markup goes inside the shorten form.
+	Markup template.HTML
+	// TokenField is the form field the widget submits its token in.
+	TokenField string
+	// CSP lists extra Content-Security-Policy sources by directive.
+	CSP map[string][]string
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return &http.Client{Timeout: 5 * time.Second}
+}
+
+// pingEndpoint reports whether endpoint answers at all. Any response below
+// 500 counts, since verification endpoints reject requests without a token.
+func pingEndpoint(ctx context.Context, client *http.Client, endpoint string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient(client).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+	}
+	return nil
+}
+
+// postSiteVerify posts form to a siteverify endpoint in the format shared
+// by Turnstile, hCaptcha and reCAPTCHA, and decodes the JSON reply.
+func postSiteVerify(ctx context.Context, client *http.Client, endpoint string, form url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient(client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("siteverify returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func verifyForm(secret, token, remoteIP string) url.Values {
+	form := url.Values{"secret": {secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	return form
+}
+
+// siteKeyDiv renders the placeholder element Turnstile and hCaptcha replace
+// with their widget.
+func siteKeyDiv(class, siteKey string) template.HTML {
+	return template.HTML(`<div class="` + class + `" data-sitekey="` + template.HTMLEscapeString(siteKey) + `"></div>`)
+}
@@ -0,0 +1,184 @@
+// Package metrics exposes ShortSlug's Prometheus metrics. A nil *Metrics is
+// valid and records nothing, so callers don't need to check whether metrics
+// are enabled.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type Metrics struct {
+	registry         *prometheus.Registry
+	shortens         *prometheus.CounterVec
+	redirects        *prometheus.CounterVec
+	botVerifications *prometheus.CounterVec
+	botDuration      prometheus.Histogram
+	storeDuration    *prometheus.HistogramVec
+	storeErrors      *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		shortens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shortslug_shorten_requests_total",
+			Help: "Shorten requests by outcome: created, rejected, unauthorized, conflict, rate_limited or error.",
+		}, []string{"outcome"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shortslug_redirects_total",
+			Help: "Short link visits by result: hit, miss, expired, locked, limited, blocked, warned, quarantined or error.",
+		}, []string{"result"}),
+		// The bot metrics keep the names they had when Cap was the only
+		// provider, so existing dashboards keep working.
+		botVerifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shortslug_cap_verifications_total",
+			Help: "Bot verification results from the configured provider: success or failure.",
+		}, []string{"result"}),
+		botDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "shortslug_cap_verify_duration_seconds",
+			Help:    "Time spent verifying bot challenge tokens.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "shortslug_store_query_duration_seconds",
+			Help:    "Latency of store calls by method.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"method"}),
+		storeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shortslug_store_errors_total",
+			Help: "Store calls that failed, by method. Expected outcomes such as a taken alias are not counted.",
+		}, []string{"method"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.shortens,
+		m.redirects,
+		m.botVerifications,
+		m.botDuration,
+		m.storeDuration,
+		m.storeErrors,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) Shorten(outcome string) {
+	if m == nil {
+		return
+	}
+	m.shortens.WithLabelValues(outcome).Inc()
+}
+
+func (m *Metrics) Redirect(result string) {
+	if m == nil {
+		return
+	}
+	m.redirects.WithLabelValues(result).Inc()
+}
+
+func (m *Metrics) BotVerification(err error, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.botVerifications.WithLabelValues(result).Inc()
+	m.botDuration.Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) observeStore(method string, start time.Time, failed bool) {
+	if m == nil {
+		return
+	}
+	m.storeDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if failed {
+		m.storeErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// Sizer is implemented by stores that can report their on-disk size.
+type Sizer interface {
+	Size(ctx context.Context) (int64, error)
+}
+
+// RegisterDBSize exports shortslug_database_size_bytes, read from s on each
+// scrape.
+func (m *Metrics) RegisterDBSize(s Sizer) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(&dbSizeCollector{
+		sizer: s,
+		desc:  prometheus.NewDesc("shortslug_database_size_bytes", "Size of the database.", nil, nil),
+	})
+}
+
+type dbSizeCollector struct {
+	sizer Sizer
+	desc  *prometheus.Desc
+}
+
+func (c *dbSizeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *dbSizeCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	size, err := c.sizer.Size(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(size))
+}
+
+// Pinger is implemented by bot verifiers, whose provider may be unreachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// RegisterBotProvider exports shortslug_bot_provider_up, 1 when p answers
+// and 0 when it doesn't, checked on each scrape. The provider is outside our
+// control, so it is watched here rather than failing readiness.
+func (m *Metrics) RegisterBotProvider(p Pinger) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(&botProviderCollector{
+		pinger: p,
+		desc:   prometheus.NewDesc("shortslug_bot_provider_up", "Whether the bot verification provider's endpoint answers.", nil, nil),
+	})
+}
+
+type botProviderCollector struct {
+	pinger Pinger
+	desc   *prometheus.Desc
+}
+
+func (c *botProviderCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *botProviderCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	up := 1.0
+	if err := c.pinger.Ping(ctx); err != nil {
+		up = 0
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, up)
+}
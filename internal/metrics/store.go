@@ -0,0 +1,222 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+)
+
+// InstrumentStore wraps s so every call is timed and failures are counted.
+func InstrumentStore(s store.Store, m *Metrics) store.Store {
+	if m == nil {
+		return s
+	}
+	return &instrumentedStore{next: s, m: m}
+}
+
+type instrumentedStore struct {
+	next store.Store
+	m    *Metrics
+}
+
+// failed reports whether err is a real failure rather than one of the
+// store's expected outcomes.
+func failed(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, expected := range []error{store.ErrCodeTaken, store.ErrReservedCode, store.ErrInvalidCode, store.ErrLinkExpired} {
+		if errors.Is(err, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *instrumentedStore) CreateShortURL(ctx context.Context, originalURL string) (string, error) {
+	start := time.Now()
+	code, err := s.next.CreateShortURL(ctx, originalURL)
+	s.m.observeStore("CreateShortURL", start, failed(err))
+	return code, err
+}
+
+func (s *instrumentedStore) CreateShortURLWithOptions(ctx context.Context, originalURL string, opts store.CreateOptions) (string, error) {
+	start := time.Now()
+	code, err := s.next.CreateShortURLWithOptions(ctx, originalURL, opts)
+	s.m.observeStore("CreateShortURLWithOptions", start, failed(err))
+	return code, err
+}
+
+func (s *instrumentedStore) ResolveShortURL(ctx context.Context, code string) (store.Link, bool, error) {
+	start := time.Now()
+	link, ok, err := s.next.ResolveShortURL(ctx, code)
+	s.m.observeStore("ResolveShortURL", start, failed(err))
+	return link, ok, err
+}
+
+func (s *instrumentedStore) GetLink(ctx context.Context, code string) (store.Link, bool, error) {
+	start := time.Now()
+	link, ok, err := s.next.GetLink(ctx, code)
+	s.m.observeStore("GetLink", start, failed(err))
+	return link, ok, err
+}
+
+func (s *instrumentedStore) ListLinks(ctx context.Context, offset, limit int) ([]store.Link, error) {
+	start := time.Now()
+	results, err := s.next.ListLinks(ctx, offset, limit)
+	s.m.observeStore("ListLinks", start, failed(err))
+	return results, err
+}
+
+func (s *instrumentedStore) UpdateLink(ctx context.Context, code string, update store.LinkUpdate) (store.Link, bool, error) {
+	start := time.Now()
+	link, ok, err := s.next.UpdateLink(ctx, code, update)
+	s.m.observeStore("UpdateLink", start, failed(err))
+	return link, ok, err
+}
+
+func (s *instrumentedStore) DeleteLink(ctx context.Context, code string) (bool, error) {
+	start := time.Now()
+	ok, err := s.next.DeleteLink(ctx, code)
+	s.m.observeStore("DeleteLink", start, failed(err))
+	return ok, err
+}
+
+func (s *instrumentedStore) RecordClick(ctx context.Context, code string, click store.Click) error {
+	start := time.Now()
+	err := s.next.RecordClick(ctx, code, click)
+	s.m.observeStore("RecordClick", start, failed(err))
+	return err
+}
+
+func (s *instrumentedStore) ClickTimeseries(ctx context.Context, code string, bucketSeconds, from, to int64) ([]store.TimeBucket, bool, error) {
+	start := time.Now()
+	results, ok, err := s.next.ClickTimeseries(ctx, code, bucketSeconds, from, to)
+	s.m.observeStore("ClickTimeseries", start, failed(err))
+	return results, ok, err
+}
+
+func (s *instrumentedStore) Summary(ctx context.Context) (store.Summary, error) {
+	start := time.Now()
+	summary, err := s.next.Summary(ctx)
+	s.m.observeStore("Summary", start, failed(err))
+	return summary, err
+}
+
+func (s *instrumentedStore) Top(ctx context.Context, limit int) ([]store.LinkInfo, error) {
+	start := time.Now()
+	results, err := s.next.Top(ctx, limit)
+	s.m.observeStore("Top", start, failed(err))
+	return results, err
+}
+
+func (s *instrumentedStore) Recent(ctx context.Context, limit int) ([]store.LinkInfo, error) {
+	start := time.Now()
+	results, err := s.next.Recent(ctx, limit)
+	s.m.observeStore("Recent", start, failed(err))
+	return results, err
+}
+
+func (s *instrumentedStore) CreateAPIKey(ctx context.Context, key store.APIKey) (int64, error) {
+	start := time.Now()
+	id, err := s.next.CreateAPIKey(ctx, key)
+	s.m.observeStore("CreateAPIKey", start, failed(err))
+	return id, err
+}
+
+func (s *instrumentedStore) LookupAPIKey(ctx context.Context, hash string) (store.APIKey, bool, error) {
+	start := time.Now()
+	key, ok, err := s.next.LookupAPIKey(ctx, hash)
+	s.m.observeStore("LookupAPIKey", start, failed(err))
+	return key, ok, err
+}
+
+func (s *instrumentedStore) ListAPIKeys(ctx context.Context) ([]store.APIKey, error) {
+	start := time.Now()
+	results, err := s.next.ListAPIKeys(ctx)
+	s.m.observeStore("ListAPIKeys", start, failed(err))
+	return results, err
+}
+
+func (s *instrumentedStore) RevokeAPIKey(ctx context.Context, id int64) (bool, error) {
+	start := time.Now()
+	ok, err := s.next.RevokeAPIKey(ctx, id)
+	s.m.observeStore("RevokeAPIKey", start, failed(err))
+	return ok, err
+}
+
+func (s *instrumentedStore) CreateWebhook(ctx context.Context, hook store.Webhook) (int64, error) {
+	start := time.Now()
+	id, err := s.next.CreateWebhook(ctx, hook)
+	s.m.observeStore("CreateWebhook", start, failed(err))
+	return id, err
+}
+
+func (s *instrumentedStore) ListWebhooks(ctx context.Context) ([]store.Webhook, error) {
+	start := time.Now()
+	results, err := s.next.ListWebhooks(ctx)
+	s.m.observeStore("ListWebhooks", start, failed(err))
+	return results, err
+}
+
+func (s *instrumentedStore) DeleteWebhook(ctx context.Context, id int64) (bool, error) {
+	start := time.Now()
+	ok, err := s.next.DeleteWebhook(ctx, id)
+	s.m.observeStore("DeleteWebhook", start, failed(err))
+	return ok, err
+}
+
+func (s *instrumentedStore) RecordDeadLetter(ctx context.Context, letter store.DeadLetter) error {
+	start := time.Now()
+	err := s.next.RecordDeadLetter(ctx, letter)
+	s.m.observeStore("RecordDeadLetter", start, failed(err))
+	return err
+}
+
+func (s *instrumentedStore) ListDeadLetters(ctx context.Context, limit int) ([]store.DeadLetter, error) {
+	start := time.Now()
+	results, err := s.next.ListDeadLetters(ctx, limit)
+	s.m.observeStore("ListDeadLetters", start, failed(err))
+	return results, err
+}
+
+func (s *instrumentedStore) CreateReport(ctx context.Context, report store.Report) (int64, bool, error) {
+	start := time.Now()
+	reporters, ok, err := s.next.CreateReport(ctx, report)
+	s.m.observeStore("CreateReport", start, failed(err))
+	return reporters, ok, err
+}
+
+func (s *instrumentedStore) ListReports(ctx context.Context, code string, limit int) ([]store.Report, error) {
+	start := time.Now()
+	results, err := s.next.ListReports(ctx, code, limit)
+	s.m.observeStore("ListReports", start, failed(err))
+	return results, err
+}
+
+func (s *instrumentedStore) ClearReports(ctx context.Context, code string) (int64, error) {
+	start := time.Now()
+	n, err := s.next.ClearReports(ctx, code)
+	s.m.observeStore("ClearReports", start, failed(err))
+	return n, err
+}
+
+func (s *instrumentedStore) SetQuarantined(ctx context.Context, code string, quarantined bool) (bool, error) {
+	start := time.Now()
+	ok, err := s.next.SetQuarantined(ctx, code, quarantined)
+	s.m.observeStore("SetQuarantined", start, failed(err))
+	return ok, err
+}
+
+func (s *instrumentedStore) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := s.next.Ping(ctx)
+	s.m.observeStore("Ping", start, failed(err))
+	return err
+}
+
+func (s *instrumentedStore) Close() error {
+	return s.next.Close()
+}
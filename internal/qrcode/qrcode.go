@@ -0,0 +1,80 @@
+// Package qrcode renders QR codes for short links as PNG or SVG. Encoding
+// is done by rsc.io/qr; this package adds the quiet zone and scales the
+// result to the requested size.
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+
+	"rsc.io/qr"
+)
+
+// quietZone is the blank border, in modules, that scanners need around a
+// code.
+const quietZone = 4
+
+func encode(text string) (*qr.Code, int, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return nil, 0, err
+	}
+	return code, code.Size + 2*quietZone, nil
+}
+
+// PNG renders text as a black-on-white PNG roughly size pixels wide. The
+// image is never smaller than one pixel per module.
+func PNG(text string, size int) ([]byte, error) {
+	code, modules, err := encode(text)
+	if err != nil {
+		return nil, err
+	}
+	scale := max(size/modules, 1)
+
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, modules*scale, modules*scale), palette)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			px, py := (x+quietZone)*scale, (y+quietZone)*scale
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(px+dx, py+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders text as a scalable SVG displayed at size pixels.
+func SVG(text string, size int) ([]byte, error) {
+	code, modules, err := encode(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, modules, modules)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+quietZone, y+quietZone)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes(), nil
+}
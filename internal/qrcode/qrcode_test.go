@@ -0,0 +1,39 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestPNGSizeAndQuietZone(t *testing.T) {
+	data, err := PNG("https://sho.rt/q3-roadmap", 256)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode png: %v", err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() != bounds.Dy() || bounds.Dx() > 256 || bounds.Dx() < 128 {
+		t.Fatalf("unexpected image size %v", bounds)
+	}
+	r, g, b, _ := img.At(0, 0).RGBA()
+	if r != 0xffff || g != 0xffff || b != 0xffff {
+		t.Fatalf("expected white quiet zone at the corner")
+	}
+}
+
+func TestSVG(t *testing.T) {
+	data, err := SVG("https://sho.rt/q3-roadmap", 200)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svg := string(data)
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, `width="200"`) || !strings.Contains(svg, "h1v1h-1z") {
+		t.Fatalf("unexpected svg: %.120s", svg)
+	}
+}
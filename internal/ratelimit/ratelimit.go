@@ -0,0 +1,122 @@
+// Package ratelimit implements per-key token buckets.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxKeys bounds memory use; beyond it, buckets that have refilled are
+// dropped, since a full bucket is the same as no bucket.
+const maxKeys = 10000
+
+// Rate allows Count requests per Per. Bursts of up to Count requests are
+// allowed, and the bucket refills evenly over Per.
+type Rate struct {
+	Count int
+	Per   time.Duration
+}
+
+// ParseRate parses rates such as "30/m", "5/s" or "1000/h". "", "0" and
+// "off" return the zero Rate, which disables limiting.
+func ParseRate(raw string) (Rate, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "0" || strings.EqualFold(raw, "off") {
+		return Rate{}, nil
+	}
+	countRaw, unit, ok := strings.Cut(raw, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q must look like 30/m", raw)
+	}
+	count, err := strconv.Atoi(countRaw)
+	if err != nil || count < 0 {
+		return Rate{}, fmt.Errorf("rate %q must start with a non-negative count", raw)
+	}
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Rate{}, fmt.Errorf("rate %q must be per s, m or h", raw)
+	}
+	return Rate{Count: count, Per: per}, nil
+}
+
+// Limiter tracks a token bucket for each key. A nil Limiter allows every
+// request.
+type Limiter struct {
+	mu      sync.Mutex
+	burst   float64
+	perSec  float64
+	buckets map[string]bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a Limiter for rate, or nil when rate disables limiting.
+func New(rate Rate) *Limiter {
+	if rate.Count <= 0 || rate.Per <= 0 {
+		return nil
+	}
+	return &Limiter{
+		burst:   float64(rate.Count),
+		perSec:  float64(rate.Count) / rate.Per.Seconds(),
+		buckets: make(map[string]bucket),
+	}
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxKeys {
+			l.prune(now)
+		}
+		b = bucket{tokens: l.burst, last: now}
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+
+	if b.tokens < 1 {
+		l.buckets[key] = b
+		wait := time.Duration(math.Ceil((1 - b.tokens) / l.perSec * float64(time.Second)))
+		return false, wait
+	}
+	b.tokens--
+	l.buckets[key] = b
+	return true, 0
+}
+
+func (l *Limiter) refill(b bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return min(l.burst, b.tokens+elapsed*l.perSec)
+}
+
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want Rate
+	}{
+		{raw: "30/m", want: Rate{Count: 30, Per: time.Minute}},
+		{raw: "5/s", want: Rate{Count: 5, Per: time.Second}},
+		{raw: " 1000/h ", want: Rate{Count: 1000, Per: time.Hour}},
+		{raw: "", want: Rate{}},
+		{raw: "off", want: Rate{}},
+	}
+	for _, tc := range cases {
+		got, err := ParseRate(tc.raw)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.raw, err)
+		}
+		if got != tc.want {
+			t.Fatalf("parse %q: expected %+v, got %+v", tc.raw, tc.want, got)
+		}
+	}
+	for _, raw := range []string{"30", "30/d", "-1/m", "x/m"} {
+		if _, err := ParseRate(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	l := New(Rate{Count: 3, Per: 3 * time.Second})
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a", now); !ok {
+			t.Fatalf("expected request %d of the burst to pass", i+1)
+		}
+	}
+	ok, wait := l.Allow("a", now)
+	if ok {
+		t.Fatalf("expected the bucket to be empty")
+	}
+	if wait != time.Second {
+		t.Fatalf("expected to wait 1s, got %v", wait)
+	}
+	if ok, _ := l.Allow("b", now); !ok {
+		t.Fatalf("expected other keys to have their own bucket")
+	}
+
+	if ok, _ := l.Allow("a", now.Add(time.Second)); !ok {
+		t.Fatalf("expected a token after refilling")
+	}
+	if ok, _ := l.Allow("a", now.Add(time.Second)); ok {
+		t.Fatalf("expected only one token to have refilled")
+	}
+}
+
+func TestNilLimiterAllows(t *testing.T) {
+	l := New(Rate{})
+	if l != nil {
+		t.Fatalf("expected a zero rate to disable the limiter")
+	}
+	if ok, _ := l.Allow("a", time.Now()); !ok {
+		t.Fatalf("expected a nil limiter to allow requests")
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type requestLogKey struct{}
+
+// requestLog collects details handlers learn while serving a request that
+// belong in its access log line.
+type requestLog struct {
+	code string
+}
+
+// logCode records the short code a request resolved to.
+func logCode(r *http.Request, code string) {
+	if rl, ok := r.Context().Value(requestLogKey{}).(*requestLog); ok {
+		rl.code = code
+	}
+}
+
+// serveLogged runs next and writes one access log record for the request.
+// Server errors are logged at error level and everything else at info,
+// except successful health probes, which are logged at debug.
+func (s *Server) serveLogged(w http.ResponseWriter, r *http.Request, next func(http.ResponseWriter, *http.Request)) {
+	start := time.Now()
+	rl := &requestLog{}
+	rec := &statusRecorder{ResponseWriter: w}
+	next(rec, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, rl)))
+
+	status := rec.Status()
+	level := slog.LevelInfo
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	} else if isProbe(r.URL.Path) {
+		level = slog.LevelDebug
+	}
+	if !s.logger.Enabled(r.Context(), level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Int("status", status),
+		slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		slog.Int64("bytes", rec.bytes),
+		slog.String("client_ip", s.clientIP(r)),
+		slog.String("user_agent", r.UserAgent()),
+	}
+	if rl.code != "" {
+		attrs = append(attrs, slog.String("code", rl.code))
+	}
+	s.logger.LogAttrs(r.Context(), level, "request", attrs...)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+)
+
+const (
+	maxTimeseriesBuckets = 1000
+	// maxTimestamp is the end of year 9999. Bounding from and to keeps the
+	// bucket arithmetic below from overflowing.
+	maxTimestamp = 253402300799
+)
+
+var timeseriesIntervals = map[string]struct {
+	width         time.Duration
+	defaultWindow time.Duration
+}{
+	"hour": {width: time.Hour, defaultWindow: 48 * time.Hour},
+	"day":  {width: 24 * time.Hour, defaultWindow: 30 * 24 * time.Hour},
+}
+
+func (s *Server) handleTimeseries(w http.ResponseWriter, r *http.Request, code string) {
+	query := r.URL.Query()
+
+	intervalName := query.Get("interval")
+	if intervalName == "" {
+		intervalName = "hour"
+	}
+	interval, ok := timeseriesIntervals[intervalName]
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "interval must be hour or day.")
+		return
+	}
+	width := int64(interval.width / time.Second)
+
+	to, err := parseTimeParam(query.Get("to"), time.Now().Unix())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "to must be unix seconds or RFC 3339.")
+		return
+	}
+	from, err := parseTimeParam(query.Get("from"), to-int64(interval.defaultWindow/time.Second))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "from must be unix seconds or RFC 3339.")
+		return
+	}
+
+	if from < 0 || to < 0 || from > maxTimestamp || to > maxTimestamp {
+		writeError(w, r, http.StatusBadRequest, "from and to must be between 1970 and 9999.")
+		return
+	}
+	if from >= to {
+		writeError(w, r, http.StatusBadRequest, "from must be before to.")
+		return
+	}
+
+	// Align to bucket boundaries so every bucket covers a full interval.
+	from -= mod(from, width)
+	if rem := mod(to, width); rem != 0 {
+		to += width - rem
+	}
+	if (to-from)/width > maxTimeseriesBuckets {
+		writeError(w, r, http.StatusBadRequest, "Time range is too large for the requested interval.")
+		return
+	}
+
+	buckets, ok, err := s.store.ClickTimeseries(r.Context(), code, width, from, to)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, store.LinkTimeseries{
+		Code:     code,
+		Interval: intervalName,
+		From:     from,
+		To:       to,
+		Buckets:  fillBuckets(buckets, from, to, width),
+	})
+}
+
+// fillBuckets expands the sparse store result into one bucket per interval
+// so clients can plot it directly.
+func fillBuckets(sparse []store.TimeBucket, from, to, width int64) []store.TimeBucket {
+	counts := make(map[int64]int64, len(sparse))
+	for _, b := range sparse {
+		counts[b.Start] = b.Clicks
+	}
+	filled := make([]store.TimeBucket, 0, (to-from)/width)
+	for start := from; start < to; start += width {
+		filled = append(filled, store.TimeBucket{Start: start, Clicks: counts[start]})
+	}
+	return filled
+}
+
+func parseTimeParam(raw string, fallback int64) (int64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return fallback, nil
+	}
+	if secs, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return secs, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.Unix(), nil
+	}
+	return 0, errors.New("unrecognized time format")
+}
+
+func mod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
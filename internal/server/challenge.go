@@ -0,0 +1,36 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/StealthBadger747/ShortSlug/internal/bot"
+)
+
+// handleChallenge hands out proof-of-work challenges when the bot verifier
+// issues its own. Challenges are counted per network, like reports, so a
+// client can't dodge its share by rotating addresses within one.
+func (s *Server) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	challenger, ok := s.verifier.(bot.Challenger)
+	if !ok || !s.botCheckEnabled() {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	challenge, err := challenger.Challenge(anonymizeIP(s.clientIP(r)))
+	if errors.Is(err, bot.ErrClientChallengeLimit) {
+		w.Header().Set("Retry-After", "60")
+		writeError(w, r, http.StatusTooManyRequests, "Too many requests. Please wait a moment and try again.")
+		return
+	}
+	if errors.Is(err, bot.ErrTooManyChallenges) {
+		w.Header().Set("Retry-After", "60")
+		writeError(w, r, http.StatusServiceUnavailable, "Too many people are shortening links right now. Please try again in a minute.")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to create a challenge.")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, challenge)
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// defaultTrustedProxies covers loopback and private networks, where reverse
+// proxies and ingress controllers usually run.
+var defaultTrustedProxies = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+}
+
+// ParseTrustedProxies parses a comma-separated list of CIDRs or addresses.
+// "none" trusts no proxy, so forwarding headers are always ignored.
+func ParseTrustedProxies(raw string) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	if strings.EqualFold(strings.TrimSpace(raw), "none") {
+		return prefixes, nil
+	}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", part)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", part)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// WithTrustedProxies sets which peers may report the client address through
+// Forwarded, X-Forwarded-For or X-Real-IP. The default trusts loopback and
+// private networks.
+func WithTrustedProxies(prefixes []netip.Prefix) Option {
+	return func(s *Server) {
+		s.trustedProxies = prefixes
+	}
+}
+
+// clientIPForRequest returns the address of the client. Forwarding headers
+// are only read when the connection comes from a trusted proxy, and the
+// client is the nearest hop that isn't one, so addresses a client prepends
+// itself are ignored.
+func clientIPForRequest(r *http.Request, trusted []netip.Prefix) string {
+	remote := parseForwardedIP(r.RemoteAddr)
+	if !isTrustedProxy(remote, trusted) {
+		return remote
+	}
+	if hops := forwardedForValues(r.Header.Values("Forwarded")); len(hops) > 0 {
+		return nearestUntrustedHop(hops, trusted, remote)
+	}
+	if hops := csvTokens(r.Header.Values("X-Forwarded-For")); len(hops) > 0 {
+		return nearestUntrustedHop(hops, trusted, remote)
+	}
+	if ip := parseForwardedIP(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	return remote
+}
+
+func (s *Server) clientIP(r *http.Request) string {
+	return clientIPForRequest(r, s.trustedProxies)
+}
+
+// nearestUntrustedHop walks the proxy chain from the closest hop outward.
+// An unparseable hop ends the walk at the last address seen.
+func nearestUntrustedHop(hops []string, trusted []netip.Prefix, remote string) string {
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseForwardedIP(hops[i])
+		if ip == "" {
+			break
+		}
+		client = ip
+		if !isTrustedProxy(ip, trusted) {
+			break
+		}
+	}
+	return client
+}
+
+func isTrustedProxy(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func csvTokens(values []string) []string {
+	var tokens []string
+	for _, raw := range values {
+		for _, part := range strings.Split(raw, ",") {
+			if tok := strings.TrimSpace(part); tok != "" {
+				tokens = append(tokens, tok)
+			}
+		}
+	}
+	return tokens
+}
+
+// forwardedForValues returns the for= parameter of every element of the
+// RFC 7239 Forwarded headers, in order.
+func forwardedForValues(values []string) []string {
+	var hops []string
+	for _, element := range csvTokens(values) {
+		for _, kv := range strings.Split(element, ";") {
+			key, val, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hops = append(hops, strings.Trim(strings.TrimSpace(val), "\""))
+			}
+		}
+	}
+	return hops
+}
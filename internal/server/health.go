@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const readinessTimeout = 3 * time.Second
+
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// WithBotReadinessCheck decides whether /readyz also requires the bot
+// verification provider to answer. It does by default; turn it off when a
+// provider outage shouldn't take every replica out of rotation and the
+// shortslug_bot_provider_up metric is watched instead.
+func WithBotReadinessCheck(enabled bool) Option {
+	return func(s *Server) {
+		s.readyChecksBot = enabled
+	}
+}
+
+// handleHealthz reports that the process is up and serving.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports whether the server can handle traffic: the store is
+// reachable with every migration applied, and the bot verification provider
+// answers when bot filtering and its readiness check are enabled. Failure
+// details are logged rather than returned, as the endpoint is public.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	result := readiness{Status: "ok", Checks: map[string]string{}}
+	check := func(name string, err error) {
+		if err == nil {
+			result.Checks[name] = "ok"
+			return
+		}
+		result.Status = "unavailable"
+		result.Checks[name] = "failing"
+		if s.logger != nil {
+			s.logger.WarnContext(ctx, "readiness check failed", "check", name, "error", err)
+		}
+	}
+
+	check("store", s.store.Ping(ctx))
+	if s.readyChecksBot && s.botCheckEnabled() {
+		check("bot", s.verifier.Ping(ctx))
+	}
+
+	status := http.StatusOK
+	if result.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, result)
+}
+
+// isProbe reports whether path is one of the health endpoints, whose
+// successful requests are only logged at debug level.
+func isProbe(path string) bool {
+	return path == "/healthz" || path == "/readyz"
+}
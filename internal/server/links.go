@@ -0,0 +1,203 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+)
+
+const maxNotesLen = 1000
+
+type linkList struct {
+	Links      []store.Link `json:"links"`
+	NextOffset int          `json:"next_offset,omitempty"`
+}
+
+type linkPatch struct {
+	URL            *string `json:"url"`
+	ExpiresAt      *int64  `json:"expires_at"`
+	MaxClicks      *int64  `json:"max_clicks"`
+	Notes          *string `json:"notes"`
+	RedirectStatus *int    `json:"redirect_status"`
+	Passthrough    *bool   `json:"passthrough"`
+	Password       *string `json:"password"`
+}
+
+func (s *Server) handleAPIv1(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/v1/")
+
+	if rest == "links" {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.handleListLinks(w, r)
+		return
+	}
+
+	if rest == "reports" {
+		s.handleListReports(w, r)
+		return
+	}
+
+	if link, ok := strings.CutPrefix(rest, "links/"); ok {
+		if code, sub, ok := strings.Cut(link, "/"); ok && code != "" {
+			switch sub {
+			case "reports":
+				s.handleLinkReports(w, r, code)
+				return
+			case "quarantine":
+				s.handleQuarantine(w, r, code)
+				return
+			}
+		}
+	}
+
+	if rest == "webhooks" || strings.HasPrefix(rest, "webhooks/") {
+		if s.webhooks == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.handleWebhooks(w, r, strings.TrimPrefix(strings.TrimPrefix(rest, "webhooks"), "/"))
+		return
+	}
+
+	if code, ok := strings.CutPrefix(rest, "links/"); ok && code != "" && !strings.Contains(code, "/") {
+		switch r.Method {
+		case http.MethodGet:
+			s.handleGetLink(w, r, code)
+		case http.MethodPatch:
+			s.handlePatchLink(w, r, code)
+		case http.MethodDelete:
+			s.handleDeleteLink(w, r, code)
+		default:
+			w.Header().Set("Allow", "GET, PATCH, DELETE")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (s *Server) handleListLinks(w http.ResponseWriter, r *http.Request) {
+	limit := parseLimit(r.URL.Query().Get("limit"))
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	// Fetch one extra row to learn whether another page exists.
+	links, err := s.store.ListLinks(r.Context(), offset, limit+1)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	result := linkList{Links: links}
+	if len(links) > limit {
+		result.Links = links[:limit]
+		result.NextOffset = offset + limit
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleGetLink(w http.ResponseWriter, r *http.Request, code string) {
+	link, ok, err := s.store.GetLink(r.Context(), code)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Link not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, link)
+}
+
+func (s *Server) handlePatchLink(w http.ResponseWriter, r *http.Request, code string) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var patch linkPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	update := store.LinkUpdate{
+		ExpiresAt:      patch.ExpiresAt,
+		MaxClicks:      patch.MaxClicks,
+		Notes:          patch.Notes,
+		RedirectStatus: patch.RedirectStatus,
+		Passthrough:    patch.Passthrough,
+	}
+	if patch.URL != nil {
+		normalized, err := s.destinationURL(r, *patch.URL)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		update.URL = &normalized
+	}
+	if patch.ExpiresAt != nil && *patch.ExpiresAt != 0 && *patch.ExpiresAt <= time.Now().Unix() {
+		writeError(w, r, http.StatusBadRequest, "expires_at must be in the future, or 0 to clear it.")
+		return
+	}
+	if patch.MaxClicks != nil && *patch.MaxClicks < 0 {
+		writeError(w, r, http.StatusBadRequest, "max_clicks must be positive, or 0 to clear it.")
+		return
+	}
+	if patch.Notes != nil && len(*patch.Notes) > maxNotesLen {
+		writeError(w, r, http.StatusBadRequest, "Notes are limited to 1000 characters.")
+		return
+	}
+	if patch.RedirectStatus != nil && *patch.RedirectStatus != 0 && !validRedirectStatus(*patch.RedirectStatus) {
+		writeError(w, r, http.StatusBadRequest, "redirect_status must be 301, 302, 307 or 308, or 0 for the server default.")
+		return
+	}
+
+	if patch.Password != nil {
+		if len(*patch.Password) > maxLinkPasswordLen {
+			writeError(w, r, http.StatusBadRequest, "password is limited to 72 bytes.")
+			return
+		}
+		hash := ""
+		if *patch.Password != "" {
+			var err error
+			if hash, err = hashLinkPassword(*patch.Password); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		update.PasswordHash = &hash
+	}
+
+	link, ok, err := s.store.UpdateLink(r.Context(), code, update)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Link not found.")
+		return
+	}
+	writeJSON(w, http.StatusOK, link)
+}
+
+func (s *Server) handleDeleteLink(w http.ResponseWriter, r *http.Request, code string) {
+	ok, err := s.store.DeleteLink(r.Context(), code)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Link not found.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
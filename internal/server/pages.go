@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+var pageLayout = template.Must(template.New("layout").Parse(`<!DOCTYPE html>
+<html lang="en">
+  <head>
+    <meta charset="UTF-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1" />
+    <meta name="robots" content="noindex" />
+    <title>{{ .Title }} · {{ .BrandName }}</title>
+    <link rel="stylesheet" href="/styles.css" />
+  </head>
+  <body>
+    <main class="container">
+      <section class="card">
+        <header class="card-header">
+          <h1>{{ .Title }}</h1>
+        </header>
+        {{ template "content" .Data }}
+        <p class="result-hint"><a class="result-link" href="/">{{ .BrandName }}</a></p>
+      </section>
+    </main>
+  </body>
+</html>
+`))
+
+var statusPage = mustPage(`{{ define "content" }}<p>{{ .Message }}</p>{{ end }}`)
+
+// warningPage stands in for a redirect the visitor should think twice
+// about following. Continuing posts back to the short link, which counts
+// the click and redirects.
+var warningPage = mustPage(`{{ define "content" }}<form class="result" method="post">
+  <div class="alert error">{{ .Message }}</div>
+  <p class="result-label">Destination</p>
+  <p class="preview-value">{{ .URL }}</p>
+  <input type="hidden" name="confirm" value="1" />
+  <button type="submit">Continue anyway</button>
+</form>{{ end }}`)
+
+func mustPage(content string) *template.Template {
+	return template.Must(template.Must(pageLayout.Clone()).Parse(content))
+}
+
+type statusPageData struct {
+	Message string
+}
+
+type warningPageData struct {
+	Message string
+	URL     string
+}
+
+func (s *Server) renderPage(w http.ResponseWriter, status int, tmpl *template.Template, title string, data any) {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, struct {
+		BrandName string
+		Title     string
+		Data      any
+	}{
+		BrandName: s.brandName,
+		Title:     title,
+		Data:      data,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+func (s *Server) renderWarning(w http.ResponseWriter, message, target string) {
+	w.Header().Set("Cache-Control", "no-store")
+	allowFormRedirects(w)
+	s.renderPage(w, http.StatusOK, warningPage, "Suspicious link", warningPageData{Message: message, URL: target})
+}
+
+// allowFormRedirects lets a page's form lead to another site. Browsers
+// apply form-action to where the form's response redirects, and a link's
+// destination is usually elsewhere.
+func allowFormRedirects(w http.ResponseWriter) {
+	w.Header().Set("Content-Security-Policy", strings.Replace(w.Header().Get("Content-Security-Policy"), "form-action 'self'", "form-action 'self' http: https:", 1))
+}
+
+func (s *Server) renderStatusPage(w http.ResponseWriter, status int, title, message string) {
+	s.renderPage(w, status, statusPage, title, statusPageData{Message: message})
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/threatlist"
+)
+
+var previewPage = mustPage(`{{ define "content" }}<div class="result">
+  <p class="result-label">Short URL</p>
+  <p class="preview-value">{{ .ShortURL }}</p>
+  <p class="result-label">Destination</p>
+  <p class="preview-value">{{ if .Protected }}Hidden until the link's password is entered.{{ else }}{{ .URL }}{{ end }}</p>
+  <p class="result-label">Created</p>
+  <p class="preview-value"><time datetime="{{ .CreatedAt.Format "2006-01-02T15:04:05Z07:00" }}">{{ .CreatedAt.Format "2 Jan 2006 15:04 MST" }}</time></p>
+  <p class="result-label">Clicks</p>
+  <p class="preview-value">{{ .Clicks }}</p>
+  {{ if .Expired }}<div class="alert error">This link has expired and no longer redirects.</div>
+  {{ else if .Listed }}<div class="alert error">This link goes to a site on a list of known malicious sites.</div>
+  {{ else if .Quarantined }}<div class="alert error">This link has been reported as abusive and is waiting for review.</div>
+  {{ else if .Protected }}<a class="result-link" href="{{ .ShortURL }}">Enter password</a>
+  {{ else }}<a class="result-link" href="{{ .URL }}" rel="noopener noreferrer">Continue to destination</a>{{ end }}
+</div>
+<form class="shorten-form" method="post" action="/api/report/{{ .Code }}">
+  <p class="result-label">Report this link</p>
+  <label class="field">
+    <span>Reason</span>
+    <select name="reason" required>
+      {{ range .ReportReasons }}<option value="{{ .Value }}">{{ .Label }}</option>
+      {{ end }}
+    </select>
+  </label>
+  <label class="field">
+    <span>Details (optional)</span>
+    <textarea name="details" rows="3" maxlength="1000"></textarea>
+  </label>
+  <button type="submit">Report</button>
+</form>{{ end }}`)
+
+type previewPageData struct {
+	Code        string
+	ShortURL    string
+	URL         string
+	CreatedAt   time.Time
+	Clicks      int64
+	Expired     bool
+	Protected   bool
+	Listed      bool
+	Quarantined bool
+	// ReportReasons fills the report form's choices.
+	ReportReasons []reportReason
+}
+
+// handlePreview serves /{code}+, showing where a link goes without
+// following it or counting a click.
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request, code string) {
+	logCode(r, code)
+	link, ok, err := s.store.GetLink(r.Context(), code)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		s.renderStatusPage(w, http.StatusNotFound, "Link not found", "There is no short link with that code.")
+		return
+	}
+
+	data := previewPageData{
+		Code:          code,
+		ShortURL:      s.baseURLForRequest(r) + "/" + code,
+		URL:           link.URL,
+		CreatedAt:     time.Unix(link.CreatedAt, 0).UTC(),
+		Clicks:        link.Clicks,
+		Expired:       linkExpired(link, time.Now()),
+		Protected:     link.PasswordHash != "",
+		Listed:        s.threats.Match(link.URL) != threatlist.NotListed,
+		Quarantined:   link.Quarantined,
+		ReportReasons: reportReasons,
+	}
+	if data.Protected {
+		data.URL = ""
+	}
+	s.renderPage(w, http.StatusOK, previewPage, "Link preview", data)
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/StealthBadger747/ShortSlug/internal/qrcode"
+)
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 2048
+)
+
+// handleQR serves /{code}.qr, a QR code of the link's short URL. Rendering
+// it doesn't count as a click.
+func (s *Server) handleQR(w http.ResponseWriter, r *http.Request, code string) {
+	logCode(r, code)
+	query := r.URL.Query()
+
+	size := defaultQRSize
+	if raw := query.Get("size"); raw != "" {
+		val, err := strconv.Atoi(raw)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "size must be a whole number of pixels.")
+			return
+		}
+		size = min(max(val, minQRSize), maxQRSize)
+	}
+
+	format := strings.ToLower(query.Get("format"))
+	if format != "" && format != "png" && format != "svg" {
+		writeError(w, r, http.StatusBadRequest, "format must be png or svg.")
+		return
+	}
+
+	_, ok, err := s.store.GetLink(r.Context(), code)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	shortURL := s.baseURLForRequest(r) + "/" + code
+
+	var body []byte
+	if format == "svg" {
+		body, err = qrcode.SVG(shortURL, size)
+		w.Header().Set("Content-Type", "image/svg+xml")
+	} else {
+		body, err = qrcode.PNG(shortURL, size)
+		w.Header().Set("Content-Type", "image/png")
+	}
+	if err != nil {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Without PUBLIC_BASE_URL the encoded host comes from request headers,
+	// so a shared cache must not hand one client's QR code to another.
+	if s.publicBaseURL != "" {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/auth"
+	"github.com/StealthBadger747/ShortSlug/internal/ratelimit"
+)
+
+// RateLimits holds the limiter for each class of request. A nil limiter
+// leaves that class unlimited.
+type RateLimits struct {
+	Shorten   *ratelimit.Limiter
+	Redirect  *ratelimit.Limiter
+	Analytics *ratelimit.Limiter
+	Report    *ratelimit.Limiter
+	Challenge *ratelimit.Limiter
+}
+
+// WithRateLimits limits requests per client. Requests with a known API key
+// are counted against the key, others against the client address.
+func WithRateLimits(limits RateLimits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// allowRequest takes a token from l for the request's client, or responds
+// with 429 and reports false.
+func (s *Server) allowRequest(w http.ResponseWriter, r *http.Request, l *ratelimit.Limiter) bool {
+	ok, wait := l.Allow(s.rateLimitKey(r), time.Now())
+	if ok {
+		return true
+	}
+	seconds := max(1, int((wait+time.Second-1)/time.Second))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeError(w, r, http.StatusTooManyRequests, "Too many requests. Please wait a moment and try again.")
+	return false
+}
+
+func (s *Server) allowRedirect(w http.ResponseWriter, r *http.Request) bool {
+	if s.allowRequest(w, r, s.limits.Redirect) {
+		return true
+	}
+	s.metrics.Redirect("limited")
+	return false
+}
+
+// rateLimitKey identifies the client. A key only gets its own bucket once
+// the store knows it; otherwise every made-up token would start with a
+// full bucket and skip the per-address limit.
+func (s *Server) rateLimitKey(r *http.Request) string {
+	if token, ok := bearerToken(r); ok {
+		hash := auth.HashKey(token)
+		if _, ok, err := s.lookupAPIKey(r, hash); err == nil && ok {
+			return "key:" + hash
+		}
+	}
+	return "ip:" + s.clientIP(r)
+}
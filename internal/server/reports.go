@@ -0,0 +1,228 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/webhook"
+)
+
+const (
+	// DefaultReportThreshold is how many distinct addresses must report a
+	// link before it is quarantined.
+	DefaultReportThreshold = 3
+
+	reportPathPrefix     = "/api/report/"
+	maxReportDetailsLen  = 1000
+	quarantineWarningMsg = "This link has been reported as abusive and is waiting for review. It may try to steal your information or install harmful software."
+)
+
+type reportReason struct {
+	Value string
+	Label string
+}
+
+// reportReasons are the choices on the report form.
+var reportReasons = []reportReason{
+	{Value: "phishing", Label: "Phishing or scam"},
+	{Value: "malware", Label: "Malware"},
+	{Value: "spam", Label: "Spam"},
+	{Value: "other", Label: "Something else"},
+}
+
+type reportList struct {
+	Reports []store.Report `json:"reports"`
+}
+
+// WithReportThreshold quarantines links once n distinct addresses have
+// reported them. Zero records reports without quarantining.
+func WithReportThreshold(n int) Option {
+	return func(s *Server) {
+		s.reportThreshold = n
+	}
+}
+
+// handleReport serves POST /api/report/{code}. The preview page's form
+// posts here, so browsers get a page back and API clients get JSON.
+func (s *Server) handleReport(w http.ResponseWriter, r *http.Request, code string) {
+	logCode(r, code)
+	if code == "" || strings.Contains(code, "/") {
+		s.reportError(w, r, http.StatusNotFound, "Link not found.")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	reason := r.FormValue("reason")
+	if !validReportReason(reason) {
+		s.reportError(w, r, http.StatusBadRequest, "Choose phishing, malware, spam or other as the reason.")
+		return
+	}
+	details := strings.TrimSpace(r.FormValue("details"))
+	if len(details) > maxReportDetailsLen {
+		s.reportError(w, r, http.StatusBadRequest, "Details are limited to 1000 characters.")
+		return
+	}
+
+	report := store.Report{
+		Code:      code,
+		Reason:    reason,
+		Details:   details,
+		IP:        anonymizeIP(s.clientIP(r)),
+		CreatedAt: time.Now().Unix(),
+	}
+	reporters, ok, err := s.store.CreateReport(r.Context(), report)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		s.reportError(w, r, http.StatusNotFound, "Link not found.")
+		return
+	}
+
+	link, _, err := s.store.GetLink(r.Context(), code)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !link.Quarantined && s.reportThreshold > 0 && reporters >= int64(s.reportThreshold) {
+		if _, err := s.store.SetQuarantined(r.Context(), code, true); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		link.Quarantined = true
+		if s.logger != nil {
+			s.logger.WarnContext(r.Context(), "link quarantined", "code", code, "reporters", reporters)
+		}
+	}
+	s.webhooks.Emit(webhook.EventLinkReported, webhook.LinkReported{
+		Code:        code,
+		URL:         link.URL,
+		Report:      report,
+		Reporters:   reporters,
+		Quarantined: link.Quarantined,
+	})
+
+	if wantsHTML(r) {
+		s.renderStatusPage(w, http.StatusOK, "Report received", "Thanks for letting us know. We'll review this link.")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "received"})
+}
+
+func (s *Server) reportError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if wantsHTML(r) {
+		s.renderStatusPage(w, status, "Report not sent", message)
+		return
+	}
+	writeError(w, r, status, message)
+}
+
+// handleListReports serves GET /api/v1/reports, the newest reports across
+// every link.
+func (s *Server) handleListReports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	reports, err := s.store.ListReports(r.Context(), "", parseLimit(r.URL.Query().Get("limit")))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, reportList{Reports: reports})
+}
+
+// handleLinkReports serves /api/v1/links/{code}/reports. DELETE clears the
+// reports and lifts the link's quarantine once an admin has reviewed it.
+func (s *Server) handleLinkReports(w http.ResponseWriter, r *http.Request, code string) {
+	switch r.Method {
+	case http.MethodGet:
+		if _, ok, err := s.store.GetLink(r.Context(), code); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		} else if !ok {
+			writeError(w, r, http.StatusNotFound, "Link not found.")
+			return
+		}
+		reports, err := s.store.ListReports(r.Context(), code, parseLimit(r.URL.Query().Get("limit")))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, reportList{Reports: reports})
+	case http.MethodDelete:
+		ok, err := s.store.SetQuarantined(r.Context(), code, false)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			writeError(w, r, http.StatusNotFound, "Link not found.")
+			return
+		}
+		if _, err := s.store.ClearReports(r.Context(), code); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleQuarantine serves /api/v1/links/{code}/quarantine: PUT quarantines
+// the link by hand and DELETE releases it, keeping its reports.
+func (s *Server) handleQuarantine(w http.ResponseWriter, r *http.Request, code string) {
+	var quarantined bool
+	switch r.Method {
+	case http.MethodPut:
+		quarantined = true
+	case http.MethodDelete:
+	default:
+		w.Header().Set("Allow", "PUT, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if ok, err := s.store.SetQuarantined(r.Context(), code, quarantined); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	} else if !ok {
+		writeError(w, r, http.StatusNotFound, "Link not found.")
+		return
+	}
+	s.handleGetLink(w, r, code)
+}
+
+// adminOnly reports whether an /api/v1/ path needs the admin scope. Webhooks
+// see every event, and reports name the addresses that sent them, so
+// links:read and links:write keys don't reach either.
+func adminOnly(path string) bool {
+	rest := strings.TrimPrefix(path, "/api/v1/")
+	if rest == "webhooks" || strings.HasPrefix(rest, "webhooks/") || rest == "reports" {
+		return true
+	}
+	if link, ok := strings.CutPrefix(rest, "links/"); ok {
+		_, sub, _ := strings.Cut(link, "/")
+		return sub == "reports" || sub == "quarantine"
+	}
+	return false
+}
+
+func validReportReason(reason string) bool {
+	for _, rr := range reportReasons {
+		if rr.Value == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsHTML reports whether the request came from a browser navigating,
+// rather than from a script.
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
@@ -3,66 +3,223 @@ package server
 import (
 	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/StealthBadger747/ShortSlug/internal/auth"
 	"github.com/StealthBadger747/ShortSlug/internal/bot"
+	"github.com/StealthBadger747/ShortSlug/internal/metrics"
 	"github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/threatlist"
+	"github.com/StealthBadger747/ShortSlug/internal/urlcheck"
+	"github.com/StealthBadger747/ShortSlug/internal/webhook"
 )
 
 type Server struct {
 	frontendDir       string
 	store             store.Store
-	capVerifier       *bot.CapVerifier
-	capEndpoint       string
+	verifier          bot.Verifier
+	widget            bot.Widget
+	csp               string
 	publicBaseURL     string
 	password          string
 	brandName         string
 	analyticsPassword string
+	adminPassword     string
+	redirectStatus    int
+	visitorUnlocks    *attemptLimiter
+	linkUnlocks       *attemptLimiter
+	webhooks          *webhook.Dispatcher
+	metrics           *metrics.Metrics
+	logger            *slog.Logger
+	trustedProxies    []netip.Prefix
+	limits            RateLimits
+	urlChecker        *urlcheck.Checker
+	threats           *threatlist.List
+	threatAction      ThreatAction
+	reportThreshold   int
+	readyChecksBot    bool
 }
 
-func New(frontendDir string, store store.Store, capVerifier *bot.CapVerifier, capEndpoint string, publicBaseURL string, password string, brandName string, analyticsPassword string) *Server {
-	return &Server{
+// Option configures optional Server features.
+type Option func(*Server)
+
+// WithAdminPassword lets requests that send the password in the
+// X-Admin-Password header use the /api/v1 management API without an API key.
+func WithAdminPassword(password string) Option {
+	return func(s *Server) {
+		s.adminPassword = password
+	}
+}
+
+// WithDefaultRedirectStatus sets the status used for links that don't pick
+// their own. It must be 301, 302, 307 or 308; the default is 301.
+func WithDefaultRedirectStatus(status int) Option {
+	return func(s *Server) {
+		s.redirectStatus = status
+	}
+}
+
+// WithWebhooks emits link.created, link.clicked and link.reported events
+// through d and enables the webhook management API.
+func WithWebhooks(d *webhook.Dispatcher) Option {
+	return func(s *Server) {
+		s.webhooks = d
+	}
+}
+
+// WithMetrics records request metrics in m. They aren't served here; expose
+// m.Handler() on a listener the public can't reach. Store metrics come from
+// wrapping the store with metrics.InstrumentStore.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// WithURLChecker replaces the destination checks. The default rejects
+// private network addresses and links back to the server.
+func WithURLChecker(c *urlcheck.Checker) Option {
+	return func(s *Server) {
+		s.urlChecker = c
+	}
+}
+
+// WithLogger writes an access log record for every request to logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+func New(frontendDir string, store store.Store, verifier bot.Verifier, publicBaseURL string, password string, brandName string, analyticsPassword string, opts ...Option) *Server {
+	s := &Server{
 		frontendDir:       frontendDir,
 		store:             store,
-		capVerifier:       capVerifier,
-		capEndpoint:       capEndpoint,
+		verifier:          verifier,
 		publicBaseURL:     strings.TrimRight(publicBaseURL, "/"),
 		password:          password,
 		brandName:         brandName,
 		analyticsPassword: analyticsPassword,
+		redirectStatus:    http.StatusMovedPermanently,
+		visitorUnlocks:    newAttemptLimiter(unlockAttemptsPerVisitor, unlockWindow),
+		linkUnlocks:       newAttemptLimiter(unlockAttemptsPerLink, unlockWindow),
+		trustedProxies:    defaultTrustedProxies,
+		urlChecker:        urlcheck.New(),
+		reportThreshold:   DefaultReportThreshold,
+		readyChecksBot:    true,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	if s.botCheckEnabled() {
+		s.widget = verifier.Widget()
+	}
+	s.csp = contentSecurityPolicy(s.widget.CSP)
+	return s
+}
+
+func (s *Server) botCheckEnabled() bool {
+	return s.verifier != nil && s.verifier.Enabled()
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	setSecurityHeaders(w)
+	r = withAPIKeyLookup(r)
+	if s.logger != nil {
+		s.serveLogged(w, r, s.route)
+		return
+	}
+	s.route(w, r)
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	s.setSecurityHeaders(w)
+
+	// Health endpoints come before everything else; "healthz" and "readyz"
+	// are reserved, so no short code can shadow them.
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		switch r.URL.Path {
+		case "/healthz":
+			s.handleHealthz(w, r)
+			return
+		case "/readyz":
+			s.handleReadyz(w, r)
+			return
+		}
+	}
 
 	if r.Method == http.MethodPost && r.URL.Path == "/api/shorten_url" {
-		s.handleShorten(w, r)
+		rec := &statusRecorder{ResponseWriter: w}
+		if s.allowRequest(rec, r, s.limits.Shorten) {
+			s.handleShorten(rec, r)
+		}
+		s.metrics.Shorten(shortenOutcome(rec.Status()))
+		return
+	}
+
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, reportPathPrefix) {
+		if s.allowRequest(w, r, s.limits.Report) {
+			s.handleReport(w, r, strings.TrimPrefix(r.URL.Path, reportPathPrefix))
+		}
+		return
+	}
+
+	if r.Method == http.MethodGet && r.URL.Path == bot.PoWChallengePath {
+		if s.allowRequest(w, r, s.limits.Challenge) {
+			s.handleChallenge(w, r)
+		}
 		return
 	}
 
 	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/analytics/") {
-		if s.analyticsPassword == "" {
-			w.WriteHeader(http.StatusNotFound)
+		if !s.allowRequest(w, r, s.limits.Analytics) {
 			return
 		}
-		if !secureCompare(r.Header.Get("X-Analytics-Password"), s.analyticsPassword) {
-			w.WriteHeader(http.StatusUnauthorized)
+		if !s.authorize(w, r, auth.ScopeAnalyticsRead, "X-Analytics-Password", s.analyticsPassword) {
 			return
 		}
 		s.handleAnalytics(w, r)
 		return
 	}
 
+	if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+		scope := auth.ScopeLinksWrite
+		if adminOnly(r.URL.Path) {
+			scope = auth.ScopeAdmin
+		} else if r.Method == http.MethodGet {
+			scope = auth.ScopeLinksRead
+		}
+		if !s.authorize(w, r, scope, "X-Admin-Password", s.adminPassword) {
+			return
+		}
+		s.handleAPIv1(w, r)
+		return
+	}
+
+	// Password-protected links are unlocked by POSTing their form back to
+	// the link itself.
+	if r.Method == http.MethodPost && r.URL.Path != "/" && !strings.HasPrefix(r.URL.Path, "/api/") {
+		if s.allowRedirect(w, r) {
+			s.handleRedirect(w, r)
+		}
+		return
+	}
+
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -77,6 +234,15 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.allowRedirect(w, r) {
+		return
+	}
+
+	if code, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".qr"); ok && code != "" && !strings.Contains(code, "/") {
+		s.handleQR(w, r, code)
+		return
+	}
+
 	s.handleRedirect(w, r)
 }
 
@@ -88,50 +254,120 @@ func (s *Server) handleShorten(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if s.password != "" {
-		if r.FormValue("password") != s.password {
-			writeError(w, r, http.StatusUnauthorized, "Invalid password.")
+	// Service credentials replace the shared password and bot check, which
+	// are meant for people using the web form.
+	if token, ok := bearerToken(r); ok {
+		switch s.checkAPIKey(r, token, auth.ScopeLinksWrite) {
+		case http.StatusOK:
+		case http.StatusForbidden:
+			writeError(w, r, http.StatusForbidden, "API key is not allowed to create links.")
+			return
+		case http.StatusUnauthorized:
+			writeError(w, r, http.StatusUnauthorized, "Invalid API key.")
+			return
+		default:
+			writeError(w, r, http.StatusInternalServerError, "Failed to check API key.")
 			return
 		}
-	}
+	} else {
+		if s.password != "" {
+			if r.FormValue("password") != s.password {
+				writeError(w, r, http.StatusUnauthorized, "Invalid password.")
+				return
+			}
+		}
 
-	if s.capVerifier != nil && s.capVerifier.Enabled() {
-		token := r.FormValue("cap-token")
-		if err := s.capVerifier.Verify(r.Context(), token); err != nil {
-			writeError(w, r, http.StatusBadRequest, "Bot verification failed.")
-			return
+		if s.botCheckEnabled() {
+			token := r.FormValue(s.widget.TokenField)
+			start := time.Now()
+			err := s.verifier.Verify(r.Context(), token, s.clientIP(r))
+			s.metrics.BotVerification(err, time.Since(start))
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, "Bot verification failed.")
+				return
+			}
 		}
 	}
 
-	originalURL := strings.TrimSpace(r.FormValue("url"))
-	if originalURL == "" {
-		writeError(w, r, http.StatusBadRequest, "Please enter a URL before shortening.")
+	originalURL, err := s.destinationURL(r, r.FormValue("url"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if !strings.HasPrefix(originalURL, "http://") && !strings.HasPrefix(originalURL, "https://") {
-		originalURL = "http://" + originalURL
+	alias := strings.TrimSpace(r.FormValue("alias"))
+	if alias != "" && s.isStaticPath(alias) {
+		writeError(w, r, http.StatusBadRequest, "That alias is reserved. Please choose another.")
+		return
 	}
 
-	parsed, err := url.ParseRequestURI(originalURL)
-	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
-		writeError(w, r, http.StatusBadRequest, "That URL doesn't look valid. Check the format and try again.")
+	expiresAt, err := parseExpiresAt(r.FormValue("expires_at"), time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Expiry must be a future date (RFC 3339 or unix seconds).")
+		return
+	}
+
+	maxClicks, err := parseMaxClicks(r.FormValue("max_clicks"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Max clicks must be a positive whole number.")
+		return
+	}
+
+	redirectStatus, err := parseRedirectStatus(r.FormValue("redirect_status"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Redirect status must be 301, 302, 307 or 308.")
+		return
+	}
+
+	passthrough, err := parseBoolField(r.FormValue("passthrough"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Passthrough must be true or false.")
 		return
 	}
 
-	code, err := s.store.CreateShortURL(originalURL)
+	var passwordHash string
+	if linkPassword := r.FormValue("link_password"); linkPassword != "" {
+		if len(linkPassword) > maxLinkPasswordLen {
+			writeError(w, r, http.StatusBadRequest, "Link passwords are limited to 72 bytes.")
+			return
+		}
+		if passwordHash, err = hashLinkPassword(linkPassword); err != nil {
+			writeError(w, r, http.StatusInternalServerError, "Failed to create short URL.")
+			return
+		}
+	}
+
+	code, err := s.store.CreateShortURLWithOptions(r.Context(), originalURL, store.CreateOptions{
+		Alias:          alias,
+		ExpiresAt:      expiresAt,
+		MaxClicks:      maxClicks,
+		RedirectStatus: redirectStatus,
+		Passthrough:    passthrough,
+		PasswordHash:   passwordHash,
+	})
 	if err != nil {
-		writeError(w, r, http.StatusInternalServerError, "Failed to create short URL.")
+		switch {
+		case errors.Is(err, store.ErrCodeTaken):
+			writeError(w, r, http.StatusConflict, "That alias is already taken. Please choose another.")
+		case errors.Is(err, store.ErrReservedCode):
+			writeError(w, r, http.StatusBadRequest, "That alias is reserved. Please choose another.")
+		case errors.Is(err, store.ErrInvalidCode):
+			writeError(w, r, http.StatusBadRequest, "Aliases may only contain letters, numbers, '-' and '_'.")
+		default:
+			writeError(w, r, http.StatusInternalServerError, "Failed to create short URL.")
+		}
 		return
 	}
 
 	baseURL := s.baseURLForRequest(r)
 	shortURL := baseURL + "/" + code
+	logCode(r, code)
+	s.webhooks.Emit(webhook.EventLinkCreated, webhook.LinkCreated{Code: code, URL: originalURL, ShortURL: shortURL})
 
 	if isHtmxRequest(r) {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
-		_, _ = io.WriteString(w, renderHtmxResult(shortURL))
+		_, _ = io.WriteString(w, renderHtmxResult(shortURL, "/"+code+".qr?format=svg"))
 		return
 	}
 
@@ -144,6 +380,97 @@ func (s *Server) handleShorten(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// normalizeURL defaults bare hosts to http:// and rejects anything that
+// isn't an absolute URL. Errors are suitable for showing to the user.
+func normalizeURL(raw string) (string, error) {
+	originalURL := strings.TrimSpace(raw)
+	if originalURL == "" {
+		return "", errors.New("Please enter a URL before shortening.")
+	}
+
+	if scheme, rest, ok := strings.Cut(originalURL, ":"); ok && isSchemeName(scheme) && !startsWithPort(rest) {
+		switch scheme = strings.ToLower(scheme); scheme {
+		case "http", "https":
+			originalURL = scheme + ":" + rest
+		default:
+			return "", errors.New("Only http:// and https:// links can be shortened.")
+		}
+	} else {
+		originalURL = "http://" + originalURL
+	}
+
+	parsed, err := url.ParseRequestURI(originalURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return "", errors.New("That URL doesn't look valid. Check the format and try again.")
+	}
+	return originalURL, nil
+}
+
+// isSchemeName reports whether s looks like a URL scheme rather than a
+// host name. Dotted names are treated as hosts.
+func isSchemeName(s string) bool {
+	if s == "" || !isASCIILetter(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !isASCIILetter(c) && !(c >= '0' && c <= '9') && c != '+' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// startsWithPort reports whether rest, what follows the first colon, is a
+// port, as in "localhost:8080/path".
+func startsWithPort(rest string) bool {
+	port := rest
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		port = rest[:i]
+	}
+	if port == "" {
+		return false
+	}
+	for i := 0; i < len(port); i++ {
+		if port[i] < '0' || port[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// destinationURL normalizes raw and runs it through the destination safety
+// checks. Errors are suitable for showing to the user.
+func (s *Server) destinationURL(r *http.Request, raw string) (string, error) {
+	normalized, err := normalizeURL(raw)
+	if err != nil {
+		return "", err
+	}
+	parsed, err := url.Parse(normalized)
+	if err != nil {
+		return "", errors.New("That URL doesn't look valid. Check the format and try again.")
+	}
+	// Every name the shortener answers to counts as itself: the configured
+	// base URL, the host the request came in on and the forwarded one.
+	self := []string{r.Host}
+	for _, base := range []string{s.publicBaseURL, s.baseURLForRequest(r)} {
+		if u, err := url.Parse(base); err == nil && u.Host != "" {
+			self = append(self, u.Host)
+		}
+	}
+	if err := s.urlChecker.Check(r.Context(), parsed, self...); err != nil {
+		return "", err
+	}
+	if s.threats.Match(normalized) == threatlist.Listed {
+		return "", errListedDestination
+	}
+	return normalized, nil
+}
+
 func (s *Server) handleRedirect(w http.ResponseWriter, r *http.Request) {
 	code := strings.TrimPrefix(r.URL.Path, "/")
 	if code == "" {
@@ -151,24 +478,205 @@ func (s *Server) handleRedirect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, ok, err := s.store.ResolveShortURL(code)
+	if code, ok := strings.CutSuffix(code, "+"); ok && code != "" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.handlePreview(w, r, code)
+		return
+	}
+
+	// The link is looked up before ResolveShortURL counts a click, since
+	// deep links into non-passthrough links, locked links and warnings
+	// don't redirect.
+	code, extraPath, _ := strings.Cut(code, "/")
+	logCode(r, code)
+	link, ok, err := s.store.GetLink(r.Context(), code)
+	if err != nil {
+		s.metrics.Redirect("error")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok || (extraPath != "" && !link.Passthrough) {
+		s.metrics.Redirect("miss")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, "404 NOT FOUND!")
+		return
+	}
+
+	target := link.URL
+	if link.Passthrough {
+		target = passthroughURL(link.URL, r.URL)
+	}
+	// A bare hash prefix match may be a collision, so it only ever warns.
+	verdict := s.threats.Match(target)
+	listed := verdict != threatlist.NotListed
+	if verdict == threatlist.Listed && s.threatAction == ThreatBlock {
+		s.metrics.Redirect("blocked")
+		s.renderStatusPage(w, http.StatusForbidden, "Link blocked", "This short link goes to a site on a list of known malicious sites, so it has been disabled.")
+		return
+	}
+
+	// Password and warning forms post back here.
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+		_ = r.ParseForm()
+	}
+
+	// Warnings come before the click is counted; the visitor continues by
+	// posting back with confirm set. Expired links fall through to 410.
+	expired := linkExpired(link, time.Now())
+	warned := (listed || link.Quarantined) && !expired
+	confirmed := warned && r.PostForm.Get("confirm") != ""
+	if warned && !confirmed {
+		msg := quarantineWarningMsg
+		switch verdict {
+		case threatlist.Listed:
+			msg = threatWarningMsg
+			s.metrics.Redirect("warned")
+		case threatlist.PossiblyListed:
+			msg = possibleThreatWarningMsg
+			s.metrics.Redirect("warned")
+		default:
+			s.metrics.Redirect("quarantined")
+		}
+		s.renderWarning(w, msg, target)
+		return
+	}
+
+	unlocked := false
+	if link.PasswordHash != "" && !expired {
+		if !s.unlockLink(w, r, link, confirmed) {
+			s.metrics.Redirect("locked")
+			return
+		}
+		unlocked = true
+	} else if r.Method != http.MethodGet && !confirmed {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	link, ok, err = s.store.ResolveShortURL(r.Context(), code)
+	if errors.Is(err, store.ErrLinkExpired) {
+		s.metrics.Redirect("expired")
+		s.renderStatusPage(w, http.StatusGone, "Link expired", "This short link has expired and no longer redirects anywhere.")
+		return
+	}
 	if err != nil {
+		s.metrics.Redirect("error")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	if !ok {
+		s.metrics.Redirect("miss")
 		w.WriteHeader(http.StatusNotFound)
 		_, _ = io.WriteString(w, "404 NOT FOUND!")
 		return
 	}
+	s.metrics.Redirect("hit")
 
-	http.Redirect(w, r, url, http.StatusMovedPermanently)
+	click := s.clickForRequest(r)
+	_ = s.store.RecordClick(r.Context(), code, click)
+	s.webhooks.Emit(webhook.EventLinkClicked, webhook.LinkClicked{Code: code, URL: link.URL, Clicks: link.Clicks, Click: click})
+
+	status := link.RedirectStatus
+	if status == 0 {
+		status = s.redirectStatus
+	}
+	if unlocked || confirmed {
+		// A 307/308 would have the browser repeat the POST at the destination.
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, target, http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Cache-Control", redirectCacheControl(link, status, time.Now()))
+	http.Redirect(w, r, target, status)
+}
+
+// linkExpired reports whether a link is past its expiry or click budget.
+func linkExpired(link store.Link, now time.Time) bool {
+	return (link.ExpiresAt != 0 && link.ExpiresAt <= now.Unix()) || (link.MaxClicks != 0 && link.Clicks >= link.MaxClicks)
+}
+
+// passthroughURL appends the part of the request path after the code to
+// the destination's path and adds the request's query parameters. The
+// destination keeps its own value for any parameter it already sets, and
+// the extra path can't climb above the destination's path.
+func passthroughURL(destination string, req *url.URL) string {
+	dest, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+
+	_, extra, _ := strings.Cut(strings.TrimPrefix(req.EscapedPath(), "/"), "/")
+	if segments := resolveDotSegments(extra); len(segments) > 0 {
+		joined := "/" + strings.Join(segments, "/")
+		if strings.HasSuffix(extra, "/") {
+			joined += "/"
+		}
+		dest = dest.JoinPath(joined)
+	}
+
+	if incoming := req.Query(); len(incoming) > 0 {
+		query := dest.Query()
+		for key, values := range incoming {
+			if _, ok := query[key]; !ok {
+				query[key] = values
+			}
+		}
+		dest.RawQuery = query.Encode()
+	}
+	return dest.String()
+}
+
+// resolveDotSegments drops "." and ".." segments from an escaped path,
+// popping a segment for each "..". Segments are compared decoded, since
+// browsers also treat "%2e%2e" as "..", but kept in their escaped form.
+func resolveDotSegments(escaped string) []string {
+	var out []string
+	for seg := range strings.SplitSeq(escaped, "/") {
+		decoded, err := url.PathUnescape(seg)
+		if err != nil {
+			decoded = seg
+		}
+		switch decoded {
+		case "", ".":
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+	return out
+}
+
+// redirectCacheControl lets browsers and proxies cache permanent redirects
+// for a day, but not past the link's expiry. Temporary redirects and links
+// with a click budget must reach the server on every visit.
+func redirectCacheControl(link store.Link, status int, now time.Time) string {
+	if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+		return "no-store"
+	}
+	if link.MaxClicks != 0 {
+		return "no-store"
+	}
+	maxAge := int64(24 * time.Hour / time.Second)
+	if link.ExpiresAt != 0 {
+		maxAge = min(maxAge, link.ExpiresAt-now.Unix())
+	}
+	if maxAge <= 0 {
+		return "no-store"
+	}
+	return fmt.Sprintf("public, max-age=%d", maxAge)
 }
 
 func (s *Server) handleAnalytics(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
 	case "/api/analytics/summary":
-		summary, err := s.store.Summary()
+		summary, err := s.store.Summary(r.Context())
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -176,7 +684,7 @@ func (s *Server) handleAnalytics(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, summary)
 	case "/api/analytics/top":
 		limit := parseLimit(r.URL.Query().Get("limit"))
-		links, err := s.store.Top(limit)
+		links, err := s.store.Top(r.Context(), limit)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -184,13 +692,17 @@ func (s *Server) handleAnalytics(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, links)
 	case "/api/analytics/recent":
 		limit := parseLimit(r.URL.Query().Get("limit"))
-		links, err := s.store.Recent(limit)
+		links, err := s.store.Recent(r.Context(), limit)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 		writeJSON(w, http.StatusOK, links)
 	default:
+		if code, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/analytics/links/"), "/timeseries"); ok && code != "" && !strings.Contains(code, "/") {
+			s.handleTimeseries(w, r, code)
+			return
+		}
 		w.WriteHeader(http.StatusNotFound)
 	}
 }
@@ -225,6 +737,13 @@ func (s *Server) tryServeStatic(w http.ResponseWriter, r *http.Request) bool {
 	return true
 }
 
+// isStaticPath reports whether name matches a file in the frontend directory,
+// which would shadow a short code with the same name.
+func (s *Server) isStaticPath(name string) bool {
+	info, err := os.Stat(filepath.Join(s.frontendDir, filepath.FromSlash(path.Clean("/"+name))))
+	return err == nil && !info.IsDir()
+}
+
 func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, file string) {
 	filePath := filepath.Join(s.frontendDir, file)
 	http.ServeFile(w, r, filePath)
@@ -238,15 +757,23 @@ func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_ = tmpl.Execute(w, struct {
+	data := struct {
+		BotScripts      []string
+		BotWidget       template.HTML
 		CapAPIEndpoint  string
 		PasswordEnabled bool
 		BrandName       string
 	}{
-		CapAPIEndpoint:  s.capEndpoint,
+		BotScripts:      s.widget.Scripts,
+		BotWidget:       s.widget.Markup,
 		PasswordEnabled: s.password != "",
 		BrandName:       s.brandName,
-	})
+	}
+	// Older custom index.html files render the Cap widget themselves.
+	if capVerifier, ok := s.verifier.(*bot.CapVerifier); ok && s.botCheckEnabled() {
+		data.CapAPIEndpoint = capVerifier.APIEndpoint
+	}
+	_ = tmpl.Execute(w, data)
 }
 
 func isHtmxRequest(r *http.Request) bool {
@@ -276,24 +803,35 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
-func renderHtmxResult(shortURL string) string {
+func renderHtmxResult(shortURL, qrSrc string) string {
 	escaped := template.HTMLEscapeString(shortURL)
+	escapedQR := template.HTMLEscapeString(qrSrc)
 	return "<div class=\"result\">" +
 		"<p class=\"result-label\">Short URL</p>" +
 		"<a class=\"result-link\" href=\"" + escaped + "\" target=\"_blank\" rel=\"noopener noreferrer\">" +
 		escaped +
 		"</a>" +
+		"<a class=\"result-qr\" href=\"" + escapedQR + "\" download>" +
+		"<img src=\"" + escapedQR + "\" width=\"160\" height=\"160\" alt=\"QR code for " + escaped + "\">" +
+		"</a>" +
 		"</div>"
 }
 
+// baseURLForRequest prefers the configured base URL. Without one it is
+// rebuilt from the request, honoring forwarded headers only from trusted
+// proxies, since anyone else can set them.
 func (s *Server) baseURLForRequest(r *http.Request) string {
 	if s.publicBaseURL != "" {
 		return s.publicBaseURL
 	}
-	return fmt.Sprintf("%s://%s", schemeForRequest(r), hostForRequest(r))
+	forwarded := isTrustedProxy(parseForwardedIP(r.RemoteAddr), s.trustedProxies)
+	return fmt.Sprintf("%s://%s", schemeForRequest(r, forwarded), hostForRequest(r, forwarded))
 }
 
-func hostForRequest(r *http.Request) string {
+func hostForRequest(r *http.Request, forwarded bool) string {
+	if !forwarded {
+		return safeHost(r.Host)
+	}
 	if host := forwardedHeaderValue(r.Header.Get("Forwarded"), "host"); host != "" {
 		return safeHost(host)
 	}
@@ -306,7 +844,64 @@ func hostForRequest(r *http.Request) string {
 	return safeHost(r.Host)
 }
 
-func schemeForRequest(r *http.Request) string {
+// parseForwardedIP extracts the address from the forms proxies use:
+// "1.2.3.4", "1.2.3.4:5678", "[2001:db8::1]:4711" and bare IPv6.
+func parseForwardedIP(raw string) string {
+	raw = strings.Trim(strings.TrimSpace(raw), "\"")
+	if raw == "" {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(raw); err == nil {
+		raw = host
+	}
+	ip := net.ParseIP(strings.Trim(raw, "[]"))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// anonymizeIP zeroes the host part of an address (last octet for IPv4,
+// last 80 bits for IPv6) so stored clicks can't identify a visitor.
+func anonymizeIP(raw string) string {
+	ip := net.ParseIP(raw)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+func (s *Server) clickForRequest(r *http.Request) store.Click {
+	return store.Click{
+		At:        time.Now().Unix(),
+		Referrer:  truncate(r.Referer(), 512),
+		UserAgent: truncate(r.UserAgent(), 512),
+		IP:        anonymizeIP(s.clientIP(r)),
+	}
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8
+// sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func schemeForRequest(r *http.Request, forwarded bool) string {
+	if !forwarded {
+		if r.TLS != nil {
+			return "https"
+		}
+		return "http"
+	}
 	if proto := forwardedHeaderValue(r.Header.Get("Forwarded"), "proto"); proto != "" {
 		return sanitizeScheme(proto)
 	}
@@ -353,11 +948,44 @@ func forwardedHeaderValue(raw, key string) string {
 	return ""
 }
 
-func setSecurityHeaders(w http.ResponseWriter) {
+func (s *Server) setSecurityHeaders(w http.ResponseWriter) {
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.Header().Set("X-Frame-Options", "DENY")
 	w.Header().Set("Referrer-Policy", "no-referrer")
-	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' https://cdn.jsdelivr.net https://unpkg.com; style-src 'self' 'unsafe-inline'; object-src 'none'; frame-ancestors 'none'; base-uri 'self'; form-action 'self'")
+	w.Header().Set("Content-Security-Policy", s.csp)
+}
+
+// contentSecurityPolicy adds the sources a bot widget needs to the base
+// policy. Directives only appear when they differ from default-src.
+func contentSecurityPolicy(extra map[string][]string) string {
+	directives := []struct {
+		name    string
+		sources []string
+	}{
+		{"default-src", []string{"'self'"}},
+		{"script-src", []string{"'self'", "https://cdn.jsdelivr.net"}},
+		{"style-src", []string{"'self'", "'unsafe-inline'"}},
+		{"connect-src", nil},
+		{"frame-src", nil},
+		{"object-src", []string{"'none'"}},
+		{"frame-ancestors", []string{"'none'"}},
+		{"base-uri", []string{"'self'"}},
+		{"form-action", []string{"'self'"}},
+	}
+	parts := make([]string, 0, len(directives))
+	for _, d := range directives {
+		sources := d.sources
+		if more := extra[d.name]; len(more) > 0 {
+			if sources == nil {
+				sources = []string{"'self'"}
+			}
+			sources = append(slices.Clip(sources), more...)
+		}
+		if len(sources) > 0 {
+			parts = append(parts, d.name+" "+strings.Join(sources, " "))
+		}
+	}
+	return strings.Join(parts, "; ")
 }
 
 func safeHost(host string) string {
@@ -389,6 +1017,79 @@ func parseLimit(raw string) int {
 	return val
 }
 
+// parseExpiresAt accepts unix seconds, RFC 3339, or the value of an HTML
+// datetime-local input (interpreted as UTC). An empty value means no expiry.
+func parseExpiresAt(raw string, now time.Time) (int64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+
+	var expires time.Time
+	if secs, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		expires = time.Unix(secs, 0)
+	} else if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		expires = t
+	} else if t, err := time.Parse("2006-01-02T15:04", raw); err == nil {
+		expires = t
+	} else {
+		return 0, errors.New("unrecognized expiry format")
+	}
+
+	if !expires.After(now) {
+		return 0, errors.New("expiry is in the past")
+	}
+	return expires.Unix(), nil
+}
+
+func parseMaxClicks(raw string) (int64, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	val, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || val <= 0 {
+		return 0, errors.New("max clicks must be positive")
+	}
+	return val, nil
+}
+
+// parseRedirectStatus accepts an empty value (server default) or one of the
+// redirect statuses a link may use.
+func parseRedirectStatus(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	val, err := strconv.Atoi(raw)
+	if err != nil || !validRedirectStatus(val) {
+		return 0, errors.New("unsupported redirect status")
+	}
+	return val, nil
+}
+
+// parseBoolField accepts the values an HTML checkbox or API client is
+// likely to send; an empty value is false.
+func parseBoolField(raw string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", "0", "false", "off", "no":
+		return false, nil
+	case "1", "true", "on", "yes":
+		return true, nil
+	default:
+		return false, errors.New("invalid boolean")
+	}
+}
+
+func validRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
 func shouldCacheStatic(cleanPath string) bool {
 	switch strings.ToLower(path.Ext(cleanPath)) {
 	case ".css", ".js", ".png", ".jpg", ".jpeg", ".gif", ".svg", ".ico", ".webp":
@@ -1,16 +1,36 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"image/png"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 
+	"github.com/StealthBadger747/ShortSlug/internal/auth"
+	"github.com/StealthBadger747/ShortSlug/internal/bot"
+	"github.com/StealthBadger747/ShortSlug/internal/metrics"
+	"github.com/StealthBadger747/ShortSlug/internal/ratelimit"
+	shortstore "github.com/StealthBadger747/ShortSlug/internal/store"
 	"github.com/StealthBadger747/ShortSlug/internal/store/sqlite"
+	"github.com/StealthBadger747/ShortSlug/internal/threatlist"
+	"github.com/StealthBadger747/ShortSlug/internal/urlcheck"
+	"github.com/StealthBadger747/ShortSlug/internal/webhook"
 )
 
 func TestShortenRedirectAndAnalytics(t *testing.T) {
@@ -25,7 +45,7 @@ func TestShortenRedirectAndAnalytics(t *testing.T) {
 	}
 	t.Cleanup(func() { _ = store.Close() })
 
-	srv := httptest.NewServer(New(frontendDir, store, nil, "", "", "", "ShortSlug", "secret"))
+	srv := httptest.NewServer(New(frontendDir, store, nil, "", "", "ShortSlug", "secret"))
 	defer srv.Close()
 
 	form := url.Values{}
@@ -124,7 +144,7 @@ func TestShortenUsesConfiguredPublicBaseURL(t *testing.T) {
 	}
 	t.Cleanup(func() { _ = store.Close() })
 
-	srv := httptest.NewServer(New(frontendDir, store, nil, "", "https://sho.rt", "", "ShortSlug", ""))
+	srv := httptest.NewServer(New(frontendDir, store, nil, "https://sho.rt", "", "ShortSlug", ""))
 	defer srv.Close()
 
 	form := url.Values{}
@@ -159,13 +179,14 @@ func TestShortenUsesForwardedHeadersForBaseURL(t *testing.T) {
 	}
 	t.Cleanup(func() { _ = store.Close() })
 
-	h := New(frontendDir, store, nil, "", "", "", "ShortSlug", "")
+	h := New(frontendDir, store, nil, "", "", "ShortSlug", "")
 	form := strings.NewReader("url=example.com")
 	req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", form)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("X-Forwarded-Proto", "https")
 	req.Header.Set("X-Forwarded-Host", "slug.example.com")
 	req.Host = "internal:8080"
+	req.RemoteAddr = "10.0.0.2:4000"
 	rr := httptest.NewRecorder()
 
 	h.ServeHTTP(rr, req)
@@ -196,12 +217,13 @@ func TestShortenUsesRFCForwardedHeader(t *testing.T) {
 	}
 	t.Cleanup(func() { _ = store.Close() })
 
-	h := New(frontendDir, store, nil, "", "", "", "ShortSlug", "")
+	h := New(frontendDir, store, nil, "", "", "ShortSlug", "")
 	form := strings.NewReader("url=example.com")
 	req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", form)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Forwarded", "for=1.2.3.4;proto=https;host=go.example.net")
 	req.Host = "internal:8080"
+	req.RemoteAddr = "10.0.0.2:4000"
 	rr := httptest.NewRecorder()
 
 	h.ServeHTTP(rr, req)
@@ -232,7 +254,7 @@ func TestSecurityHeadersPresent(t *testing.T) {
 	}
 	t.Cleanup(func() { _ = store.Close() })
 
-	h := New(frontendDir, store, nil, "", "", "", "ShortSlug", "")
+	h := New(frontendDir, store, nil, "", "", "ShortSlug", "")
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	rr := httptest.NewRecorder()
 
@@ -252,6 +274,1536 @@ func TestSecurityHeadersPresent(t *testing.T) {
 	}
 }
 
+func TestShortenWithAlias(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	h := New(frontendDir, store, nil, "https://sho.rt", "", "ShortSlug", "")
+
+	shorten := func(rawURL, alias string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Set("url", rawURL)
+		form.Set("alias", alias)
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := shorten("example.org/roadmap", "q3-roadmap")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var body struct {
+		ShortURL string `json:"short_url"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("decode json: %v", err)
+	}
+	if body.ShortURL != "https://sho.rt/q3-roadmap" {
+		t.Fatalf("unexpected short url %q", body.ShortURL)
+	}
+
+	if rr := shorten("example.org/other", "q3-roadmap"); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for taken alias, got %d", rr.Code)
+	}
+	if rr := shorten("example.org/other", "api"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for reserved alias, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/q3-roadmap", nil)
+	redirect := httptest.NewRecorder()
+	h.ServeHTTP(redirect, req)
+	if redirect.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected 301, got %d", redirect.Code)
+	}
+	if loc := redirect.Header().Get("Location"); loc != "http://example.org/roadmap" {
+		t.Fatalf("unexpected location %q", loc)
+	}
+}
+
+func TestRedirectExpiredLink(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	h := New(frontendDir, store, nil, "https://sho.rt", "", "Acme Links", "")
+
+	form := url.Values{}
+	form.Set("url", "example.org/onboarding")
+	form.Set("alias", "welcome")
+	form.Set("max_clicks", "1")
+	form.Set("expires_at", time.Now().Add(time.Hour).Format(time.RFC3339))
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	first := httptest.NewRecorder()
+	h.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/welcome", nil))
+	if first.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected first visit to redirect, got %d", first.Code)
+	}
+
+	second := httptest.NewRecorder()
+	h.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/welcome", nil))
+	if second.Code != http.StatusGone {
+		t.Fatalf("expected 410 once the click budget is spent, got %d", second.Code)
+	}
+	if !strings.Contains(second.Body.String(), "Acme Links") {
+		t.Fatalf("expected branded expiry page, got %q", second.Body.String())
+	}
+
+	form.Set("alias", "")
+	form.Set("expires_at", "2001-01-01T00:00:00Z")
+	req = httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for past expiry, got %d", rr.Code)
+	}
+}
+
+func TestAnalyticsTimeseries(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	code, err := store.CreateShortURL(t.Context(), "http://example.com")
+	if err != nil {
+		t.Fatalf("create short url: %v", err)
+	}
+	day := int64(86400)
+	for _, at := range []int64{day + 10, day + 20, 3*day + 5} {
+		if err := store.RecordClick(t.Context(), code, shortstore.Click{At: at}); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	h := New(frontendDir, store, nil, "", "", "ShortSlug", "secret")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Analytics-Password", "secret")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get(fmt.Sprintf("/api/analytics/links/%s/timeseries?interval=day&from=0&to=%d", code, 4*day))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var series shortstore.LinkTimeseries
+	if err := json.NewDecoder(rr.Body).Decode(&series); err != nil {
+		t.Fatalf("decode timeseries: %v", err)
+	}
+	if len(series.Buckets) != 4 {
+		t.Fatalf("expected 4 zero-filled buckets, got %+v", series.Buckets)
+	}
+	wantClicks := []int64{0, 2, 0, 1}
+	for i, b := range series.Buckets {
+		if b.Start != int64(i)*day || b.Clicks != wantClicks[i] {
+			t.Fatalf("bucket %d: unexpected %+v", i, b)
+		}
+	}
+
+	if rr := get("/api/analytics/links/missing/timeseries"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown code, got %d", rr.Code)
+	}
+	if rr := get("/api/analytics/links/" + code + "/timeseries?interval=week"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown interval, got %d", rr.Code)
+	}
+	for _, q := range []string{
+		"from=-9000000000000000000&to=9000000000000000000",
+		"from=0&to=9223372036854775807",
+		"from=100&to=50",
+	} {
+		if rr := get("/api/analytics/links/" + code + "/timeseries?interval=hour&" + q); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", q, rr.Code)
+		}
+	}
+}
+
+func TestLinkManagementAPI(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	code, err := store.CreateShortURL(t.Context(), "http://exmaple.com/docs")
+	if err != nil {
+		t.Fatalf("create short url: %v", err)
+	}
+
+	h := New(frontendDir, store, nil, "", "", "ShortSlug", "", WithAdminPassword("admin"))
+
+	do := func(method, path, body, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Admin-Password", password)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do(http.MethodGet, "/api/v1/links", "", "wrong"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without admin password, got %d", rr.Code)
+	}
+
+	rr := do(http.MethodPatch, "/api/v1/links/"+code, `{"url":"https://example.org/docs","notes":"typo fix"}`, "admin")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 from patch, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var link shortstore.Link
+	if err := json.NewDecoder(rr.Body).Decode(&link); err != nil {
+		t.Fatalf("decode link: %v", err)
+	}
+	if link.URL != "https://example.org/docs" || link.Notes != "typo fix" {
+		t.Fatalf("unexpected patched link: %+v", link)
+	}
+
+	redirect := httptest.NewRecorder()
+	h.ServeHTTP(redirect, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+	if loc := redirect.Header().Get("Location"); loc != "https://example.org/docs" {
+		t.Fatalf("expected redirect to new destination, got %q", loc)
+	}
+
+	if rr := do(http.MethodPatch, "/api/v1/links/"+code, `{"url":"not a url"}`, "admin"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid destination, got %d", rr.Code)
+	}
+
+	rr = do(http.MethodGet, "/api/v1/links?limit=5", "", "admin")
+	var list struct {
+		Links []shortstore.Link `json:"links"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(list.Links) != 1 || list.Links[0].Code != code {
+		t.Fatalf("unexpected list: %+v", list.Links)
+	}
+
+	if rr := do(http.MethodDelete, "/api/v1/links/"+code, "", "admin"); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 from delete, got %d", rr.Code)
+	}
+	if rr := do(http.MethodGet, "/api/v1/links/"+code, "", "admin"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", rr.Code)
+	}
+}
+
+func TestAPIKeyAuthorization(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	mint := func(scopes ...string) (string, int64) {
+		plaintext, prefix, hash, err := auth.NewKey()
+		if err != nil {
+			t.Fatalf("new key: %v", err)
+		}
+		id, err := store.CreateAPIKey(t.Context(), shortstore.APIKey{Name: "test", Prefix: prefix, Hash: hash, Scopes: scopes})
+		if err != nil {
+			t.Fatalf("create api key: %v", err)
+		}
+		return plaintext, id
+	}
+	writer, _ := mint(auth.ScopeLinksWrite)
+	reader, readerID := mint(auth.ScopeAnalyticsRead)
+
+	h := New(frontendDir, store, nil, "", "shorten-secret", "ShortSlug", "")
+
+	shorten := func(key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader("url=example.org"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+key)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	summary := func(key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/analytics/summary", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := shorten(writer); code != http.StatusOK {
+		t.Fatalf("expected links:write key to shorten without the shared password, got %d", code)
+	}
+	if code := shorten(reader); code != http.StatusForbidden {
+		t.Fatalf("expected analytics key to be forbidden from shortening, got %d", code)
+	}
+	if code := shorten("ss_bogus"); code != http.StatusUnauthorized {
+		t.Fatalf("expected unknown key to be rejected, got %d", code)
+	}
+
+	if code := summary(reader); code != http.StatusOK {
+		t.Fatalf("expected analytics:read key to read analytics, got %d", code)
+	}
+	if code := summary(writer); code != http.StatusForbidden {
+		t.Fatalf("expected links:write key to be forbidden from analytics, got %d", code)
+	}
+	if code := summary(""); code != http.StatusNotFound {
+		t.Fatalf("expected analytics to stay hidden without credentials, got %d", code)
+	}
+
+	if _, err := store.RevokeAPIKey(t.Context(), readerID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if code := summary(reader); code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked key to be rejected, got %d", code)
+	}
+}
+
+func TestClientIPAndAnonymization(t *testing.T) {
+	cases := []struct {
+		name    string
+		headers map[string]string
+		remote  string
+		want    string
+	}{
+		{name: "remote addr", remote: "198.51.100.7:5555", want: "198.51.100.0"},
+		{name: "forwarded", headers: map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711";proto=https`}, remote: "10.0.0.1:1", want: "2001:db8:cafe::"},
+		{name: "x-forwarded-for", headers: map[string]string{"X-Forwarded-For": "203.0.113.9, 10.0.0.1"}, remote: "10.0.0.1:1", want: "203.0.113.0"},
+		{name: "garbage", headers: map[string]string{"X-Forwarded-For": "unknown"}, remote: "192.0.2.44:80", want: "192.0.2.0"},
+		{name: "untrusted peer", headers: map[string]string{"X-Forwarded-For": "203.0.113.9"}, remote: "198.51.100.7:5555", want: "198.51.100.0"},
+		{name: "spoofed hop", headers: map[string]string{"X-Forwarded-For": "203.0.113.9, 198.51.100.7"}, remote: "10.0.0.1:1", want: "198.51.100.0"},
+		{name: "proxy chain", headers: map[string]string{"X-Forwarded-For": "203.0.113.9, 192.168.1.5"}, remote: "10.0.0.1:1", want: "203.0.113.0"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		req.RemoteAddr = tc.remote
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		if got := anonymizeIP(clientIPForRequest(req, defaultTrustedProxies)); got != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestTruncateKeepsUTF8Valid(t *testing.T) {
+	cases := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"abcdef", 3, "abc"},
+		{"héllo", 2, "h"},
+		{"日本語", 4, "日"},
+		{"日本語", 6, "日本"},
+	}
+	for _, tc := range cases {
+		got := truncate(tc.in, tc.n)
+		if got != tc.want || !utf8.ValidString(got) {
+			t.Fatalf("truncate(%q, %d): expected %q, got %q", tc.in, tc.n, tc.want, got)
+		}
+	}
+}
+
+func TestQRCode(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	h := New(frontendDir, store, nil, "https://sho.rt", "", "ShortSlug", "")
+
+	form := url.Values{}
+	form.Set("url", "example.org/spring-poster")
+	form.Set("alias", "poster")
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `src="/poster.qr?format=svg"`) {
+		t.Fatalf("expected QR image in htmx result, got %q", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/poster.qr?size=300", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected png, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if cc := rr.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "public") {
+		t.Fatalf("expected a shareable QR code with PUBLIC_BASE_URL set, got %q", cc)
+	}
+	img, err := png.Decode(rr.Body)
+	if err != nil {
+		t.Fatalf("decode png: %v", err)
+	}
+	if size := img.Bounds().Dx(); size > 300 || size < 150 {
+		t.Fatalf("unexpected png size %d", size)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/poster.qr?format=svg", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("expected svg, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/poster.qr?format=gif", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/missing.qr", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown code, got %d", rr.Code)
+	}
+
+	link, ok, err := store.GetLink(t.Context(), "poster")
+	if err != nil || !ok {
+		t.Fatalf("get link: %v %v", ok, err)
+	}
+	if link.Clicks != 0 {
+		t.Fatalf("expected QR requests not to count clicks, got %d", link.Clicks)
+	}
+
+	// Without a configured base URL the code depends on forwarded headers.
+	h = New(frontendDir, store, nil, "", "", "ShortSlug", "")
+	req = httptest.NewRequest(http.MethodGet, "/poster.qr", nil)
+	req.RemoteAddr = "10.0.0.2:4000"
+	req.Header.Set("X-Forwarded-Host", "evil.example")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if cc := rr.Header().Get("Cache-Control"); rr.Code != http.StatusOK || !strings.HasPrefix(cc, "private") {
+		t.Fatalf("expected a private QR code without PUBLIC_BASE_URL, got %d %q", rr.Code, cc)
+	}
+}
+
+func TestRedirectStatus(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	h := New(frontendDir, store, nil, "https://sho.rt", "", "ShortSlug", "", WithDefaultRedirectStatus(http.StatusFound))
+
+	shorten := func(fields map[string]string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		for k, v := range fields {
+			form.Set(k, v)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	cases := []struct {
+		fields       map[string]string
+		wantStatus   int
+		wantCache    string
+		wantCachePfx string
+	}{
+		{fields: map[string]string{"url": "example.org/a", "alias": "default"}, wantStatus: http.StatusFound, wantCache: "no-store"},
+		{fields: map[string]string{"url": "example.org/b", "alias": "moved", "redirect_status": "308"}, wantStatus: http.StatusPermanentRedirect, wantCache: "public, max-age=86400"},
+		{fields: map[string]string{"url": "example.org/c", "alias": "counted", "redirect_status": "301", "max_clicks": "5"}, wantStatus: http.StatusMovedPermanently, wantCache: "no-store"},
+		{fields: map[string]string{"url": "example.org/d", "alias": "soon", "redirect_status": "301", "expires_at": fmt.Sprint(time.Now().Add(time.Hour).Unix())}, wantStatus: http.StatusMovedPermanently, wantCachePfx: "public, max-age=3"},
+	}
+	for _, tc := range cases {
+		if rr := shorten(tc.fields); rr.Code != http.StatusOK {
+			t.Fatalf("shorten %v: expected 200, got %d", tc.fields, rr.Code)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+tc.fields["alias"], nil))
+		if rr.Code != tc.wantStatus {
+			t.Fatalf("%s: expected status %d, got %d", tc.fields["alias"], tc.wantStatus, rr.Code)
+		}
+		cache := rr.Header().Get("Cache-Control")
+		if (tc.wantCache != "" && cache != tc.wantCache) || !strings.HasPrefix(cache, tc.wantCachePfx) {
+			t.Fatalf("%s: unexpected Cache-Control %q", tc.fields["alias"], cache)
+		}
+	}
+
+	if rr := shorten(map[string]string{"url": "example.org/e", "redirect_status": "303"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unsupported redirect status, got %d", rr.Code)
+	}
+}
+
+func TestPassthroughRedirect(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	h := New(frontendDir, store, nil, "https://sho.rt", "", "ShortSlug", "")
+
+	if _, err := store.CreateShortURLWithOptions(t.Context(), "https://docs.example.com/v2?lang=en", shortstore.CreateOptions{Alias: "docs", Passthrough: true}); err != nil {
+		t.Fatalf("create passthrough link: %v", err)
+	}
+	if _, err := store.CreateShortURLWithOptions(t.Context(), "https://example.com/plain", shortstore.CreateOptions{Alias: "plain"}); err != nil {
+		t.Fatalf("create plain link: %v", err)
+	}
+
+	cases := []struct {
+		path       string
+		wantStatus int
+		wantTarget string
+	}{
+		{path: "/docs/api/keys?utm_source=poster&lang=de", wantStatus: http.StatusMovedPermanently, wantTarget: "https://docs.example.com/v2/api/keys?lang=en&utm_source=poster"},
+		{path: "/docs/guides/", wantStatus: http.StatusMovedPermanently, wantTarget: "https://docs.example.com/v2/guides/?lang=en"},
+		{path: "/docs/a/../../../etc", wantStatus: http.StatusMovedPermanently, wantTarget: "https://docs.example.com/v2/etc?lang=en"},
+		{path: "/docs/%2e%2e/%2E%2e/admin", wantStatus: http.StatusMovedPermanently, wantTarget: "https://docs.example.com/v2/admin?lang=en"},
+		{path: "/docs/guides/.%2e/%2e/faq", wantStatus: http.StatusMovedPermanently, wantTarget: "https://docs.example.com/v2/faq?lang=en"},
+		{path: "/plain?utm_source=poster", wantStatus: http.StatusMovedPermanently, wantTarget: "https://example.com/plain"},
+		{path: "/plain/extra", wantStatus: http.StatusNotFound},
+		{path: "/missing/extra", wantStatus: http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rr.Code != tc.wantStatus {
+			t.Fatalf("%s: expected status %d, got %d", tc.path, tc.wantStatus, rr.Code)
+		}
+		if got := rr.Header().Get("Location"); got != tc.wantTarget {
+			t.Fatalf("%s: expected Location %q, got %q", tc.path, tc.wantTarget, got)
+		}
+	}
+
+	link, _, err := store.GetLink(t.Context(), "plain")
+	if err != nil {
+		t.Fatalf("get link: %v", err)
+	}
+	if link.Clicks != 1 {
+		t.Fatalf("expected rejected deep link not to count a click, got %d", link.Clicks)
+	}
+}
+
+func TestPasswordProtectedLink(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	h := New(frontendDir, store, nil, "https://sho.rt", "", "ShortSlug", "")
+
+	form := url.Values{}
+	form.Set("url", "https://docs.example.com/board-minutes")
+	form.Set("alias", "minutes")
+	form.Set("link_password", "correct horse")
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	unlock := func(password, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/minutes", strings.NewReader(url.Values{"password": {password}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, path := range []string{"/minutes", "/minutes+"} {
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, rr.Code)
+		}
+		if strings.Contains(rr.Body.String(), "board-minutes") {
+			t.Fatalf("%s: destination leaked before unlocking: %q", path, rr.Body.String())
+		}
+	}
+
+	if rr := unlock("wrong", "192.0.2.1:1234"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for wrong password, got %d", rr.Code)
+	}
+	rr = unlock("correct horse", "192.0.2.1:1234")
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "https://docs.example.com/board-minutes" {
+		t.Fatalf("expected 303 to destination, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	for i := 0; i < 5; i++ {
+		unlock("guess", "198.51.100.9:1234")
+	}
+	rr = unlock("correct horse", "198.51.100.9:1234")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After after repeated failures, got %d", rr.Code)
+	}
+	if rr := unlock("correct horse", "203.0.113.5:1234"); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected other visitors to be unaffected, got %d", rr.Code)
+	}
+
+	// Guesses sent at once must not all get past the limit before any of
+	// them has failed.
+	codes := make(chan int, 20)
+	var wg sync.WaitGroup
+	for range cap(codes) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- unlock("guess", "198.51.100.20:1234").Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	wrong := 0
+	for code := range codes {
+		if code == http.StatusUnauthorized {
+			wrong++
+		} else if code != http.StatusTooManyRequests {
+			t.Fatalf("expected 401 or 429 for concurrent guesses, got %d", code)
+		}
+	}
+	if wrong != 5 {
+		t.Fatalf("expected exactly 5 concurrent guesses to be checked, got %d", wrong)
+	}
+
+	link, _, err := store.GetLink(t.Context(), "minutes")
+	if err != nil {
+		t.Fatalf("get link: %v", err)
+	}
+	if link.Clicks != 2 {
+		t.Fatalf("expected only unlocked visits to count, got %d clicks", link.Clicks)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	events := make(chan string, 4)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events <- r.Header.Get("X-ShortSlug-Event")
+	}))
+	t.Cleanup(endpoint.Close)
+
+	dispatcher := webhook.New(store)
+	t.Cleanup(func() { _ = dispatcher.Close(t.Context()) })
+
+	h := New(frontendDir, store, nil, "https://sho.rt", "", "ShortSlug", "", WithAdminPassword("admin-secret"), WithWebhooks(dispatcher))
+
+	api := func(method, path, body, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Admin-Password", password)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := api(http.MethodPost, "/api/v1/webhooks", `{"url":"ftp://example.com"}`, "admin-secret"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for non-http endpoint, got %d", rr.Code)
+	}
+	if rr := api(http.MethodPost, "/api/v1/webhooks", `{"url":"https://example.com","events":["link.deleted"]}`, "admin-secret"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown event, got %d", rr.Code)
+	}
+
+	rr := api(http.MethodPost, "/api/v1/webhooks", `{"url":"`+endpoint.URL+`"}`, "admin-secret")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var created struct {
+		ID     int64  `json:"id"`
+		Secret string `json:"secret"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil || created.Secret == "" {
+		t.Fatalf("expected generated secret in response: %+v %v", created, err)
+	}
+
+	rr = api(http.MethodGet, "/api/v1/webhooks", "", "admin-secret")
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), created.Secret) {
+		t.Fatalf("expected listing without secrets, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	code, err := store.CreateShortURL(t.Context(), "https://example.com/launch")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	redirect := httptest.NewRecorder()
+	h.ServeHTTP(redirect, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+	if redirect.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected redirect, got %d", redirect.Code)
+	}
+	select {
+	case event := <-events:
+		if event != webhook.EventLinkClicked {
+			t.Fatalf("expected %s event, got %q", webhook.EventLinkClicked, event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for webhook delivery")
+	}
+
+	if rr := api(http.MethodGet, "/api/v1/webhooks/dead-letters", "", "admin-secret"); rr.Code != http.StatusOK {
+		t.Fatalf("expected dead letters listing, got %d", rr.Code)
+	}
+	if rr := api(http.MethodDelete, fmt.Sprintf("/api/v1/webhooks/%d", created.ID), "", "admin-secret"); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if rr := api(http.MethodDelete, fmt.Sprintf("/api/v1/webhooks/%d", created.ID), "", "admin-secret"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for deleted webhook, got %d", rr.Code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	m := metrics.New()
+	m.RegisterDBSize(db)
+	h := New(frontendDir, metrics.InstrumentStore(db, m), nil, "https://sho.rt", "", "ShortSlug", "", WithMetrics(m))
+
+	for _, form := range []string{"url=example.org/metrics", "url=", "url=example.org/a&alias=taken", "url=example.org/b&alias=taken"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	for _, path := range []string{"/taken", "/missing"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		`shortslug_shorten_requests_total{outcome="created"} 2`,
+		`shortslug_shorten_requests_total{outcome="rejected"} 1`,
+		`shortslug_shorten_requests_total{outcome="conflict"} 1`,
+		`shortslug_redirects_total{result="hit"} 1`,
+		`shortslug_redirects_total{result="miss"} 1`,
+		`shortslug_store_query_duration_seconds_count{method="ResolveShortURL"} 1`,
+		"shortslug_database_size_bytes ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected metrics to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "shortslug_store_errors_total") {
+		t.Fatalf("expected a taken alias not to count as a store error")
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected metrics not to be served publicly, got %d", rr.Code)
+	}
+}
+
+func TestLinkPreview(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	store, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	h := New(frontendDir, store, nil, "https://sho.rt", "", "Acme Links", "")
+
+	code, err := store.CreateShortURL(t.Context(), "https://example.com/docs?a=1&b=<2>")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code+"+", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected preview page, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{"https://example.com/docs?a=1&amp;b=&lt;2&gt;", "https://sho.rt/" + code, "Acme Links"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected preview to contain %q, got %q", want, body)
+		}
+	}
+
+	link, _, err := store.GetLink(t.Context(), code)
+	if err != nil {
+		t.Fatalf("get link: %v", err)
+	}
+	if link.Clicks != 0 {
+		t.Fatalf("expected preview not to count a click, got %d", link.Clicks)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/missing+", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown code, got %d", rr.Code)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	h := New(frontendDir, db, nil, "https://sho.rt", "", "ShortSlug", "", WithLogger(logger))
+
+	code, err := db.CreateShortURL(t.Context(), "https://example.com/logged")
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/"+code, nil)
+	req.RemoteAddr = "10.0.0.2:4000"
+	req.Header.Set("User-Agent", "log-test")
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decode log record %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"msg":        "request",
+		"level":      "INFO",
+		"method":     http.MethodGet,
+		"path":       "/" + code,
+		"status":     float64(http.StatusMovedPermanently),
+		"code":       code,
+		"client_ip":  "198.51.100.7",
+		"user_agent": "log-test",
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Fatalf("expected %s=%v, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["latency_ms"]; !ok {
+		t.Fatalf("expected latency_ms in %v", entry)
+	}
+
+	buf.Reset()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if strings.Contains(buf.String(), `"code"`) {
+		t.Fatalf("expected no code for a non-link request, got %s", buf.String())
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	capServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(capServer.Close)
+	verifier := &bot.CapVerifier{SiteVerifyURL: capServer.URL, Secret: "secret"}
+	m := metrics.New()
+	m.RegisterBotProvider(verifier)
+	h := New(frontendDir, db, verifier, "https://sho.rt", "", "ShortSlug", "", WithMetrics(m))
+	scrape := func() string {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rr.Body.String()
+	}
+
+	readyz := func() (int, readiness) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body readiness
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode readyz: %v", err)
+		}
+		return rr.Code, body
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected healthz 200, got %d", rr.Code)
+	}
+
+	if code, body := readyz(); code != http.StatusOK || body.Checks["store"] != "ok" || body.Checks["bot"] != "ok" {
+		t.Fatalf("expected ready, got %d %+v", code, body)
+	}
+	if !strings.Contains(scrape(), "shortslug_bot_provider_up 1") {
+		t.Fatalf("expected the bot provider to be up")
+	}
+
+	capServer.Close()
+	if code, body := readyz(); code != http.StatusServiceUnavailable || body.Checks["bot"] != "failing" || body.Checks["store"] != "ok" {
+		t.Fatalf("expected bot check failure, got %d %+v", code, body)
+	}
+	if !strings.Contains(scrape(), "shortslug_bot_provider_up 0") {
+		t.Fatalf("expected the bot provider to be reported down")
+	}
+
+	lenient := New(frontendDir, db, verifier, "https://sho.rt", "", "ShortSlug", "", WithBotReadinessCheck(false))
+	rr = httptest.NewRecorder()
+	lenient.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), `"bot"`) {
+		t.Fatalf("expected readiness without the bot check to pass, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	_ = db.Close()
+	if code, body := readyz(); code != http.StatusServiceUnavailable || body.Checks["store"] != "failing" {
+		t.Fatalf("expected store failure, got %d %+v", code, body)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected healthz to stay up, got %d", rr.Code)
+	}
+}
+
+// lookupCountingStore counts API key lookups.
+type lookupCountingStore struct {
+	shortstore.Store
+	lookups atomic.Int32
+}
+
+func (s *lookupCountingStore) LookupAPIKey(ctx context.Context, hash string) (shortstore.APIKey, bool, error) {
+	s.lookups.Add(1)
+	return s.Store.LookupAPIKey(ctx, hash)
+}
+
+func TestRateLimiting(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	plaintext, prefix, hash, err := auth.NewKey()
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	if _, err := db.CreateAPIKey(t.Context(), shortstore.APIKey{Name: "bulk", Prefix: prefix, Hash: hash, Scopes: []string{auth.ScopeLinksWrite}}); err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	counted := &lookupCountingStore{Store: db}
+	h := New(frontendDir, counted, nil, "https://sho.rt", "", "ShortSlug", "",
+		WithRateLimits(RateLimits{
+			Shorten:  ratelimit.New(ratelimit.Rate{Count: 2, Per: time.Minute}),
+			Redirect: ratelimit.New(ratelimit.Rate{Count: 1, Per: time.Minute}),
+		}),
+	)
+
+	shorten := func(remote, forwardedFor, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader("url=example.org/limited"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = remote
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := shorten("198.51.100.7:1000", "", ""); rr.Code != http.StatusOK {
+			t.Fatalf("expected request %d to pass, got %d", i+1, rr.Code)
+		}
+	}
+	rr := shorten("198.51.100.7:1000", "203.0.113.50", "")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 despite a spoofed X-Forwarded-For, got %d", rr.Code)
+	}
+	if retry, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || retry < 1 || retry > 30 {
+		t.Fatalf("expected Retry-After of up to 30s, got %q", rr.Header().Get("Retry-After"))
+	}
+
+	if rr := shorten("10.0.0.1:1000", "198.51.100.8", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected a different client behind the proxy to pass, got %d", rr.Code)
+	}
+	if rr := shorten("198.51.100.7:1000", "", plaintext); rr.Code != http.StatusOK {
+		t.Fatalf("expected an API key to have its own bucket, got %d", rr.Code)
+	}
+	if got := counted.lookups.Load(); got != 1 {
+		t.Fatalf("expected the API key to be looked up once per request, got %d lookups", got)
+	}
+	for i := 0; i < 3; i++ {
+		if rr := shorten("198.51.100.7:1000", "", "ss_madeup"+strconv.Itoa(i)); rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected made-up key %d to share the address's bucket, got %d", i+1, rr.Code)
+		}
+	}
+
+	code, err := db.CreateShortURL(t.Context(), "https://example.com/limited-redirect")
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	for i, want := range []int{http.StatusMovedPermanently, http.StatusTooManyRequests} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+		if rr.Code != want {
+			t.Fatalf("redirect %d: expected %d, got %d", i+1, want, rr.Code)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/analytics/summary", nil))
+	if rr.Code == http.StatusTooManyRequests {
+		t.Fatalf("expected analytics to be unlimited without a limiter")
+	}
+}
+
+func TestBotVerifierWidget(t *testing.T) {
+	frontendDir := t.TempDir()
+	index := `{{ range .BotScripts }}<script src="{{ . }}"></script>{{ end }}<form>{{ .BotWidget }}</form>`
+	if err := os.WriteFile(filepath.Join(frontendDir, "index.html"), []byte(index), 0644); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	siteverify := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok := r.FormValue("secret") == "turnstile-secret" && r.FormValue("response") == "solved"
+		_ = json.NewEncoder(w).Encode(map[string]bool{"success": ok})
+	}))
+	t.Cleanup(siteverify.Close)
+
+	verifier := &bot.TurnstileVerifier{SiteKey: "site-key", Secret: "turnstile-secret", SiteVerifyURL: siteverify.URL}
+	h := New(frontendDir, db, verifier, "https://sho.rt", "", "ShortSlug", "")
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := rr.Body.String()
+	if !strings.Contains(body, `src="https://challenges.cloudflare.com/turnstile/v0/api.js"`) || !strings.Contains(body, `class="cf-turnstile" data-sitekey="site-key"`) {
+		t.Fatalf("expected the Turnstile widget in the index, got %s", body)
+	}
+	csp := rr.Header().Get("Content-Security-Policy")
+	for _, want := range []string{"script-src 'self' https://cdn.jsdelivr.net https://challenges.cloudflare.com", "frame-src 'self' https://challenges.cloudflare.com"} {
+		if !strings.Contains(csp, want) {
+			t.Fatalf("expected CSP to contain %q, got %q", want, csp)
+		}
+	}
+	if strings.Contains(csp, "unpkg.com") {
+		t.Fatalf("expected the Cap script origin to be dropped, got %q", csp)
+	}
+
+	shorten := func(token string) int {
+		form := url.Values{"url": {"example.org/bots"}, "cf-turnstile-response": {token}}
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := shorten("forged"); code != http.StatusBadRequest {
+		t.Fatalf("expected a rejected token to return 400, got %d", code)
+	}
+	if code := shorten("solved"); code != http.StatusOK {
+		t.Fatalf("expected a solved challenge to shorten, got %d", code)
+	}
+}
+
+func TestProofOfWorkChallenge(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	h := New(frontendDir, db, bot.NewPoWVerifier([]byte("pow-key"), 8), "https://sho.rt", "", "ShortSlug", "")
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/challenge", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var challenge bot.Challenge
+	if err := json.Unmarshal(rr.Body.Bytes(), &challenge); err != nil {
+		t.Fatalf("decode challenge: %v", err)
+	}
+
+	var token string
+	for counter := 0; ; counter++ {
+		token = challenge.Challenge + ":" + strconv.Itoa(counter)
+		sum := sha256.Sum256([]byte(token))
+		if sum[0] == 0 {
+			break
+		}
+	}
+
+	shorten := func(token string) int {
+		form := url.Values{"url": {"example.org/pow"}, "pow-token": {token}}
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := shorten(""); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a solution, got %d", code)
+	}
+	if code := shorten(token); code != http.StatusOK {
+		t.Fatalf("expected a solved challenge to shorten, got %d", code)
+	}
+	if code := shorten(token); code != http.StatusBadRequest {
+		t.Fatalf("expected a replayed solution to be rejected, got %d", code)
+	}
+
+	limited := New(frontendDir, db, bot.NewPoWVerifier([]byte("pow-key"), 8), "https://sho.rt", "", "ShortSlug", "",
+		WithRateLimits(RateLimits{Challenge: ratelimit.New(ratelimit.Rate{Count: 1, Per: time.Minute})}))
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		rr = httptest.NewRecorder()
+		limited.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/challenge", nil))
+		if rr.Code != want {
+			t.Fatalf("challenge %d: expected %d, got %d", i+1, want, rr.Code)
+		}
+	}
+
+	plain := New(frontendDir, db, nil, "https://sho.rt", "", "ShortSlug", "")
+	rr = httptest.NewRecorder()
+	plain.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/challenge", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without a proof-of-work verifier, got %d", rr.Code)
+	}
+}
+
+func TestShortenRejectsUnsafeDestinations(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	checker := urlcheck.New(urlcheck.WithDenyList([]string{"phish.example"}))
+	h := New(frontendDir, db, nil, "https://sho.rt", "", "ShortSlug", "", WithURLChecker(checker), WithAdminPassword("admin"))
+
+	cases := []struct {
+		raw  string
+		want string
+	}{
+		{raw: "javascript:alert(1)", want: "Only http:// and https:// links"},
+		{raw: "FILE:///etc/passwd", want: "Only http:// and https:// links"},
+		{raw: "http://127.0.0.1:8080/admin", want: "private network"},
+		{raw: "localhost:3000", want: "private network"},
+		{raw: "https://sho.rt/abc123", want: "already a short link"},
+		{raw: "https://login.phish.example/", want: "aren't allowed"},
+		{raw: "https://bank.example@phish.example/", want: "username or password"},
+	}
+	for _, tc := range cases {
+		form := url.Values{"url": {tc.raw}}
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), tc.want) {
+			t.Fatalf("%s: expected 400 mentioning %q, got %d: %s", tc.raw, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	form := url.Values{"url": {"HTTPS://Example.org/ok"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected an uppercase scheme to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	code, err := db.CreateShortURL(t.Context(), "https://example.com/patch-me")
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodPatch, "/api/v1/links/"+code, strings.NewReader(`{"url":"http://169.254.169.254/"}`))
+	req.Header.Set("X-Admin-Password", "admin")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected PATCH to a private address to be rejected, got %d", rr.Code)
+	}
+
+	// Without a configured base URL, a client can't dodge the self-link
+	// check with its own forwarded host, and untrusted forwarded headers
+	// don't pick the short URL's host either.
+	unset := New(frontendDir, db, nil, "", "", "ShortSlug", "")
+	shorten := func(raw string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(url.Values{"url": {raw}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-Host", "x")
+		req.Host = "go.example.net"
+		rr := httptest.NewRecorder()
+		unset.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := shorten("https://go.example.net/abc123"); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "already a short link") {
+		t.Fatalf("expected a forwarded host not to hide a self link, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := shorten("https://example.com/ok"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"short_url":"http://go.example.net/`) {
+		t.Fatalf("expected an untrusted forwarded host to be ignored, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestThreatListScreensDestinations(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	feed := filepath.Join(t.TempDir(), "feed.txt")
+	if err := os.WriteFile(feed, []byte("http://malware.example/\n"), 0644); err != nil {
+		t.Fatalf("write feed: %v", err)
+	}
+	// A Safe Browsing list holds only a 4-byte prefix for phish.example.
+	prefix := sha256.Sum256([]byte("phish.example/"))
+	update := filepath.Join(t.TempDir(), "update.json")
+	if err := os.WriteFile(update, []byte(`{"listUpdateResponses":[{"threatType":"SOCIAL_ENGINEERING","responseType":"FULL_UPDATE","additions":[{"compressionType":"RAW","rawHashes":{"prefixSize":4,"rawHashes":"`+
+		base64.StdEncoding.EncodeToString(prefix[:4])+`"}}]}]}`), 0644); err != nil {
+		t.Fatalf("write update: %v", err)
+	}
+	list, err := threatlist.Load(feed, update)
+	if err != nil {
+		t.Fatalf("load threat list: %v", err)
+	}
+
+	// The link predates the list entry, so only the redirect catches it.
+	code, err := db.CreateShortURL(t.Context(), "https://malware.example/")
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	block := New(frontendDir, db, nil, "https://sho.rt", "", "ShortSlug", "", WithThreatList(list, ThreatBlock))
+	form := url.Values{"url": {"https://malware.example/"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	block.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "known malicious sites") {
+		t.Fatalf("expected a listed destination to be rejected, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	block.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+	if rr.Code != http.StatusForbidden || rr.Header().Get("Location") != "" {
+		t.Fatalf("expected a blocked redirect, got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// A prefix match is unconfirmed, so even block mode only warns.
+	form = url.Values{"url": {"https://phish.example/"}}
+	req = httptest.NewRequest(http.MethodPost, "/api/shorten_url", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	block.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected a prefix-only match to be shortened, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var created struct {
+		ShortURL string `json:"short_url"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode shorten response: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	block.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(created.ShortURL, "https://sho.rt"), nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "may go to a site") || !strings.Contains(rr.Body.String(), "https://phish.example/") {
+		t.Fatalf("expected a prefix-only match to warn, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	warn := New(frontendDir, db, nil, "https://sho.rt", "", "ShortSlug", "", WithThreatList(list, ThreatWarn))
+	rr = httptest.NewRecorder()
+	warn.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Location") != "" || !strings.Contains(rr.Body.String(), "https://malware.example/") || !strings.Contains(rr.Body.String(), `name="confirm"`) {
+		t.Fatalf("expected a warning page naming the destination, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if link, _, _ := db.GetLink(t.Context(), code); link.Clicks != 0 {
+		t.Fatalf("expected the warning page not to count a click, got %d", link.Clicks)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/"+code, strings.NewReader("confirm=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	warn.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "https://malware.example/" {
+		t.Fatalf("expected continuing past the warning to redirect, got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if link, _, _ := db.GetLink(t.Context(), code); link.Clicks != 1 {
+		t.Fatalf("expected continuing to count a click, got %d", link.Clicks)
+	}
+
+	rr = httptest.NewRecorder()
+	warn.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code+"+", nil))
+	if !strings.Contains(rr.Body.String(), "known malicious sites") || strings.Contains(rr.Body.String(), "Continue to destination") {
+		t.Fatalf("expected the preview to flag the destination, got %s", rr.Body.String())
+	}
+}
+
+func TestAbuseReportsQuarantineLinks(t *testing.T) {
+	frontendDir := t.TempDir()
+	if err := writeIndex(frontendDir); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	code, err := db.CreateShortURL(t.Context(), "https://example.org/free-prize")
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	h := New(frontendDir, db, nil, "https://sho.rt", "", "ShortSlug", "", WithAdminPassword("admin"), WithReportThreshold(2))
+
+	report := func(remoteAddr, reason, accept string) *httptest.ResponseRecorder {
+		form := url.Values{"reason": {reason}, "details": {"asks for my bank login"}}
+		req := httptest.NewRequest(http.MethodPost, "/api/report/"+code, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", accept)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	follow := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code, nil))
+		return rr
+	}
+	admin := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Admin-Password", "admin")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+code+"+", nil))
+	if !strings.Contains(rr.Body.String(), `action="/api/report/`+code+`"`) {
+		t.Fatalf("expected a report form on the preview page, got %s", rr.Body.String())
+	}
+
+	if rr := report("198.51.100.7:1234", "phishing", "application/json"); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected the report to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := report("198.51.100.8:1234", "phishing", "application/json"); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected a repeat report to be accepted, got %d", rr.Code)
+	}
+	if rr := follow(); rr.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected reports from one network to count once, got %d", rr.Code)
+	}
+	if rr := report("198.51.100.7:1234", "boring", "application/json"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown reason to be rejected, got %d", rr.Code)
+	}
+
+	rr = report("203.0.113.9:1234", "malware", "text/html,application/xhtml+xml")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Report received") {
+		t.Fatalf("expected a confirmation page, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = follow()
+	if rr.Code != http.StatusOK || rr.Header().Get("Location") != "" || !strings.Contains(rr.Body.String(), "waiting for review") {
+		t.Fatalf("expected a quarantined link to show a warning, got %d: %s", rr.Code, rr.Body.String())
+	}
+	clicks := func() int64 {
+		link, _, err := db.GetLink(t.Context(), code)
+		if err != nil {
+			t.Fatalf("get link: %v", err)
+		}
+		return link.Clicks
+	}
+	before := clicks()
+	req := httptest.NewRequest(http.MethodPost, "/"+code, strings.NewReader("confirm=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "https://example.org/free-prize" {
+		t.Fatalf("expected continuing past the quarantine warning to redirect, got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if got := clicks(); got != before+1 {
+		t.Fatalf("expected only the continued visit to count, got %d clicks after %d", got, before)
+	}
+
+	rr = admin(http.MethodGet, "/api/v1/links/"+code+"/reports")
+	var list struct {
+		Reports []shortstore.Report `json:"reports"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("decode reports: %v", err)
+	}
+	if len(list.Reports) != 3 || list.Reports[0].Reason != "malware" || list.Reports[0].IP != "203.0.113.0" {
+		t.Fatalf("unexpected reports: %+v", list.Reports)
+	}
+	if rr := admin(http.MethodGet, "/api/v1/reports"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"code":"`+code+`"`) {
+		t.Fatalf("expected the report queue to list the link, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := admin(http.MethodDelete, "/api/v1/links/"+code+"/reports"); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected reports to be cleared, got %d", rr.Code)
+	}
+	if rr := follow(); rr.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected clearing reports to lift the quarantine, got %d", rr.Code)
+	}
+
+	if rr := admin(http.MethodPut, "/api/v1/links/"+code+"/quarantine"); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"quarantined":true`) {
+		t.Fatalf("expected a manual quarantine, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := report("198.51.100.7:1234", "spam", "application/json"); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected reporting a quarantined link to work, got %d", rr.Code)
+	}
+	if rr := admin(http.MethodGet, "/api/v1/links/missing/reports"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown link, got %d", rr.Code)
+	}
+
+	plaintext, prefix, hash, err := auth.NewKey()
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	if _, err := db.CreateAPIKey(t.Context(), shortstore.APIKey{Name: "editor", Prefix: prefix, Hash: hash, Scopes: []string{auth.ScopeLinksRead, auth.ScopeLinksWrite}}); err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/reports"},
+		{http.MethodGet, "/api/v1/links/" + code + "/reports"},
+		{http.MethodDelete, "/api/v1/links/" + code + "/reports"},
+		{http.MethodDelete, "/api/v1/links/" + code + "/quarantine"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+plaintext)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("%s %s: expected a links key to be forbidden, got %d", tc.method, tc.path, rr.Code)
+		}
+	}
+}
+
 func writeIndex(dir string) error {
 	return os.WriteFile(filepath.Join(dir, "index.html"), []byte("ok"), 0644)
 }
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/StealthBadger747/ShortSlug/internal/threatlist"
+)
+
+// ThreatAction is what following a link to a listed destination does.
+type ThreatAction int
+
+const (
+	// ThreatBlock refuses to redirect to destinations whose full hash is
+	// listed. Destinations matching only a hash prefix get a warning, as
+	// there is no full-hash lookup to confirm them.
+	ThreatBlock ThreatAction = iota
+	// ThreatWarn shows a warning page the visitor can click through.
+	ThreatWarn
+)
+
+const (
+	threatWarningMsg         = "This link goes to a site on a list of known malicious sites. It may try to steal your information or install harmful software."
+	possibleThreatWarningMsg = "This link may go to a site on a list of known malicious sites. If it does, it may try to steal your information or install harmful software."
+)
+
+var errListedDestination = errors.New("That URL is on a list of known malicious sites.")
+
+// WithThreatList screens destinations against list when links are created,
+// and again when they are followed since lists change after a link is made.
+// Only confirmed matches are refused at creation.
+func WithThreatList(list *threatlist.List, action ThreatAction) Option {
+	return func(s *Server) {
+		s.threats = list
+		s.threatAction = action
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+)
+
+const (
+	// bcrypt ignores anything past 72 bytes, so longer passwords are refused
+	// rather than silently truncated.
+	maxLinkPasswordLen = 72
+
+	unlockWindow = 15 * time.Minute
+	// Failed attempts allowed per visitor and link, and per link from
+	// anyone, in each window. The per-link budget caps guessing from many
+	// addresses, at the cost of letting someone who spends it lock everyone
+	// out of the link until the window ends.
+	unlockAttemptsPerVisitor = 5
+	unlockAttemptsPerLink    = 50
+)
+
+var unlockPage = mustPage(`{{ define "content" }}<form class="shorten-form" method="post">
+  <p>This link is password protected. Enter the password you were given to continue.</p>
+  {{ if .Error }}<div class="alert error">{{ .Error }}</div>{{ end }}
+  <label class="field">
+    <span>Password</span>
+    <input type="password" name="password" autocomplete="off" required autofocus />
+  </label>
+  {{ if .Confirm }}<input type="hidden" name="confirm" value="1" />{{ end }}
+  <button type="submit">Continue</button>
+</form>{{ end }}`)
+
+type unlockPageData struct {
+	Error string
+	// Confirm carries the visitor's choice to continue past a warning.
+	Confirm bool
+}
+
+func hashLinkPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// unlockLink handles a visit to a password-protected link, whose request
+// form the caller has already parsed. Without a password it shows the
+// password form; a POST with the right password reports true so the caller
+// can redirect. Failed attempts are limited per visitor and per link.
+// confirmed keeps a visitor's choice to continue past a warning page.
+func (s *Server) unlockLink(w http.ResponseWriter, r *http.Request, link store.Link, confirmed bool) bool {
+	w.Header().Set("Cache-Control", "no-store")
+	allowFormRedirects(w)
+
+	if !r.PostForm.Has("password") {
+		s.renderPage(w, http.StatusOK, unlockPage, "Password required", unlockPageData{Confirm: confirmed})
+		return false
+	}
+
+	// Each attempt is counted as a failure before the slow bcrypt compare
+	// and refunded if it succeeds, so concurrent guesses can't all slip in
+	// under the limit.
+	now := time.Now()
+	visitorKey := s.clientIP(r) + " " + link.Code
+	wait := s.visitorUnlocks.reserve(visitorKey, now)
+	if wait == 0 {
+		if wait = s.linkUnlocks.reserve(link.Code, now); wait > 0 {
+			s.visitorUnlocks.refund(visitorKey, now)
+		}
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second)/time.Second)))
+		s.renderPage(w, http.StatusTooManyRequests, unlockPage, "Password required", unlockPageData{
+			Error:   "Too many incorrect attempts. Please wait a few minutes and try again.",
+			Confirm: confirmed,
+		})
+		return false
+	}
+
+	password := r.PostForm.Get("password")
+	if len(password) > maxLinkPasswordLen || bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+		s.renderPage(w, http.StatusUnauthorized, unlockPage, "Password required", unlockPageData{
+			Error:   "That password is incorrect.",
+			Confirm: confirmed,
+		})
+		return false
+	}
+	s.visitorUnlocks.refund(visitorKey, now)
+	s.linkUnlocks.refund(link.Code, now)
+	return true
+}
+
+// attemptLimiter counts failures per key in fixed windows.
+type attemptLimiter struct {
+	mu     sync.Mutex
+	max    int
+	window time.Duration
+	fails  map[string]attemptWindow
+}
+
+type attemptWindow struct {
+	start time.Time
+	count int
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{max: max, window: window, fails: make(map[string]attemptWindow)}
+}
+
+// reserve counts an attempt for key as failed, or returns how long key must
+// wait when it has no attempts left.
+func (l *attemptLimiter) reserve(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.fails[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		if len(l.fails) >= 10000 {
+			l.prune(now)
+		}
+		w = attemptWindow{start: now}
+	} else if w.count >= l.max {
+		return w.start.Add(l.window).Sub(now)
+	}
+	w.count++
+	l.fails[key] = w
+	return 0
+}
+
+// refund gives back an attempt reserved at now that turned out not to fail.
+func (l *attemptLimiter) refund(key string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.fails[key]
+	if !ok || now.Before(w.start) || w.count == 0 {
+		return
+	}
+	w.count--
+	l.fails[key] = w
+}
+
+func (l *attemptLimiter) prune(now time.Time) {
+	for key, w := range l.fails {
+		if now.Sub(w.start) >= l.window {
+			delete(l.fails, key)
+		}
+	}
+}
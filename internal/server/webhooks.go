@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/util"
+	"github.com/StealthBadger747/ShortSlug/internal/webhook"
+)
+
+const webhookSecretLen = 32
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// createdWebhook includes the secret, which is only shown when the webhook
+// is created.
+type createdWebhook struct {
+	store.Webhook
+	Secret string `json:"secret"`
+}
+
+// handleWebhooks serves /api/v1/webhooks; callers need the admin scope.
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request, rest string) {
+	switch {
+	case rest == "":
+		switch r.Method {
+		case http.MethodGet:
+			hooks, err := s.store.ListWebhooks(r.Context())
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, hooks)
+		case http.MethodPost:
+			s.handleCreateWebhook(w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case rest == "dead-letters":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		letters, err := s.store.ListDeadLetters(r.Context(), parseLimit(r.URL.Query().Get("limit")))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, letters)
+	default:
+		id, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			w.Header().Set("Allow", http.MethodDelete)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		ok, err := s.store.DeleteWebhook(r.Context(), id)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			writeError(w, r, http.StatusNotFound, "Webhook not found.")
+			return
+		}
+		s.webhooks.Invalidate()
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid JSON body.")
+		return
+	}
+
+	endpoint, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		writeError(w, r, http.StatusBadRequest, "url must be an absolute http or https URL.")
+		return
+	}
+	for _, event := range req.Events {
+		if !webhook.ValidEvent(event) {
+			writeError(w, r, http.StatusBadRequest, "Unknown event "+strconv.Quote(event)+".")
+			return
+		}
+	}
+
+	hook := store.Webhook{URL: endpoint.String(), Secret: req.Secret, Events: req.Events}
+	if hook.Secret == "" {
+		if hook.Secret, err = util.RandomCode(webhookSecretLen); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+
+	if hook.ID, err = s.store.CreateWebhook(r.Context(), hook); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.webhooks.Invalidate()
+	writeJSON(w, http.StatusCreated, createdWebhook{Webhook: hook, Secret: hook.Secret})
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"errors"
+	"strings"
+)
+
+const maxAliasLen = 64
+
+var (
+	ErrCodeTaken    = errors.New("short code already in use")
+	ErrReservedCode = errors.New("short code is reserved")
+	ErrInvalidCode  = errors.New("short code contains invalid characters")
+	ErrLinkExpired  = errors.New("short link has expired")
+)
+
+// reservedCodes are path segments the server routes itself. They are
+// compared case-insensitively so "API" can't shadow "/api" on case-folding
+// proxies. Static files are checked against the frontend directory
+// instead, since aliases can't contain dots.
+var reservedCodes = map[string]struct{}{
+	"api":     {},
+	"healthz": {},
+	"readyz":  {},
+}
+
+func IsReservedCode(code string) bool {
+	_, ok := reservedCodes[strings.ToLower(code)]
+	return ok
+}
+
+// ValidateAlias checks a caller-requested short code. Aliases may contain
+// letters, digits, '-' and '_' and must start with a letter or digit.
+func ValidateAlias(alias string) error {
+	if alias == "" || len(alias) > maxAliasLen {
+		return ErrInvalidCode
+	}
+	for i, r := range alias {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case (r == '-' || r == '_') && i > 0:
+		default:
+			return ErrInvalidCode
+		}
+	}
+	if IsReservedCode(alias) {
+		return ErrReservedCode
+	}
+	return nil
+}
@@ -0,0 +1,507 @@
+// Package memory is a store.Store kept entirely in process memory. It is
+// meant for tests and throwaway deployments; everything is lost on exit.
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/util"
+)
+
+const (
+	shortCodeLen = 6
+	maxAttempts  = 8
+)
+
+type link struct {
+	store.Link
+	custom bool
+}
+
+type Store struct {
+	mu        sync.Mutex
+	links     map[string]*link
+	plainURLs map[string]string
+	clicks    map[string][]store.Click
+	keys      []store.APIKey
+	webhooks  []store.Webhook
+	hookSeq   int64
+	letters   []store.DeadLetter
+	reports   []store.Report
+	reportSeq int64
+}
+
+var _ store.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{
+		links:     make(map[string]*link),
+		plainURLs: make(map[string]string),
+		clicks:    make(map[string][]store.Click),
+	}
+}
+
+func (s *Store) CreateShortURL(ctx context.Context, originalURL string) (string, error) {
+	return s.CreateShortURLWithOptions(ctx, originalURL, store.CreateOptions{})
+}
+
+func (s *Store) CreateShortURLWithOptions(ctx context.Context, originalURL string, opts store.CreateOptions) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if opts.Alias != "" {
+		if err := store.ValidateAlias(opts.Alias); err != nil {
+			return "", err
+		}
+		if existing, ok := s.links[opts.Alias]; ok {
+			// Retrying the same alias for the same URL is not a conflict.
+			if existing.URL == originalURL {
+				return opts.Alias, nil
+			}
+			return "", store.ErrCodeTaken
+		}
+		s.insert(opts.Alias, originalURL, opts)
+		return opts.Alias, nil
+	}
+
+	if !opts.Custom() {
+		if code, ok := s.plainURLs[originalURL]; ok {
+			return code, nil
+		}
+	}
+
+	for i := 0; i < maxAttempts; i++ {
+		code, err := util.RandomCode(shortCodeLen)
+		if err != nil {
+			return "", err
+		}
+		if _, taken := s.links[code]; taken || store.IsReservedCode(code) {
+			continue
+		}
+		s.insert(code, originalURL, opts)
+		return code, nil
+	}
+
+	return "", fmt.Errorf("failed to generate unique short code after %d attempts", maxAttempts)
+}
+
+func (s *Store) insert(code, originalURL string, opts store.CreateOptions) {
+	custom := opts.Custom()
+	s.links[code] = &link{
+		Link: store.Link{
+			Code:           code,
+			URL:            originalURL,
+			CreatedAt:      time.Now().Unix(),
+			ExpiresAt:      opts.ExpiresAt,
+			MaxClicks:      opts.MaxClicks,
+			RedirectStatus: opts.RedirectStatus,
+			Passthrough:    opts.Passthrough,
+			PasswordHash:   opts.PasswordHash,
+		},
+		custom: custom,
+	}
+	if !custom {
+		s.plainURLs[originalURL] = code
+	}
+}
+
+func (s *Store) ResolveShortURL(ctx context.Context, code string) (store.Link, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[code]
+	if !ok {
+		return store.Link{}, false, nil
+	}
+	if l.ExpiresAt != 0 && l.ExpiresAt <= time.Now().Unix() {
+		return store.Link{}, true, store.ErrLinkExpired
+	}
+	if l.MaxClicks != 0 && l.Clicks >= l.MaxClicks {
+		return store.Link{}, true, store.ErrLinkExpired
+	}
+	l.Clicks++
+	return l.Link, true, nil
+}
+
+func (s *Store) GetLink(ctx context.Context, code string) (store.Link, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[code]
+	if !ok {
+		return store.Link{}, false, nil
+	}
+	return l.Link, true, nil
+}
+
+func (s *Store) ListLinks(ctx context.Context, offset, limit int) ([]store.Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sorted := s.sortedLinks(func(a, b *link) bool { return false })
+	results := []store.Link{}
+	for i := offset; i < len(sorted) && len(results) < limit; i++ {
+		results = append(results, sorted[i].Link)
+	}
+	return results, nil
+}
+
+func (s *Store) UpdateLink(ctx context.Context, code string, update store.LinkUpdate) (store.Link, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[code]
+	if !ok {
+		return store.Link{}, false, nil
+	}
+	if !l.custom && s.plainURLs[l.URL] == code {
+		delete(s.plainURLs, l.URL)
+	}
+	l.custom = true
+
+	if update.URL != nil {
+		l.URL = *update.URL
+	}
+	if update.ExpiresAt != nil {
+		l.ExpiresAt = *update.ExpiresAt
+	}
+	if update.MaxClicks != nil {
+		l.MaxClicks = *update.MaxClicks
+	}
+	if update.Notes != nil {
+		l.Notes = *update.Notes
+	}
+	if update.RedirectStatus != nil {
+		l.RedirectStatus = *update.RedirectStatus
+	}
+	if update.Passthrough != nil {
+		l.Passthrough = *update.Passthrough
+	}
+	if update.PasswordHash != nil {
+		l.PasswordHash = *update.PasswordHash
+	}
+	return l.Link, true, nil
+}
+
+func (s *Store) DeleteLink(ctx context.Context, code string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[code]
+	if !ok {
+		return false, nil
+	}
+	if !l.custom && s.plainURLs[l.URL] == code {
+		delete(s.plainURLs, l.URL)
+	}
+	delete(s.links, code)
+	delete(s.clicks, code)
+	s.reports = slices.DeleteFunc(s.reports, func(r store.Report) bool { return r.Code == code })
+	return true, nil
+}
+
+func (s *Store) RecordClick(ctx context.Context, code string, click store.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clicks[code] = append(s.clicks[code], click)
+	return nil
+}
+
+func (s *Store) ClickTimeseries(ctx context.Context, code string, bucketSeconds, from, to int64) ([]store.TimeBucket, bool, error) {
+	if bucketSeconds <= 0 {
+		return nil, false, fmt.Errorf("invalid bucket width %d", bucketSeconds)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.links[code]; !ok {
+		return nil, false, nil
+	}
+
+	counts := make(map[int64]int64)
+	for _, c := range s.clicks[code] {
+		if c.At >= from && c.At < to {
+			counts[(c.At/bucketSeconds)*bucketSeconds]++
+		}
+	}
+	results := make([]store.TimeBucket, 0, len(counts))
+	for start, n := range counts {
+		results = append(results, store.TimeBucket{Start: start, Clicks: n})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Start < results[j].Start })
+	return results, true, nil
+}
+
+func (s *Store) Summary(ctx context.Context) (store.Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := store.Summary{TotalURLs: int64(len(s.links))}
+	for _, l := range s.links {
+		summary.TotalClicks += l.Clicks
+	}
+	return summary, nil
+}
+
+func (s *Store) Top(ctx context.Context, limit int) ([]store.LinkInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.linkInfos(limit, func(a, b *link) bool { return a.Clicks > b.Clicks }), nil
+}
+
+func (s *Store) Recent(ctx context.Context, limit int) ([]store.LinkInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.linkInfos(limit, func(a, b *link) bool { return false }), nil
+}
+
+func (s *Store) linkInfos(limit int, before func(a, b *link) bool) []store.LinkInfo {
+	results := []store.LinkInfo{}
+	for _, l := range s.sortedLinks(before) {
+		if len(results) >= limit {
+			break
+		}
+		results = append(results, store.LinkInfo{Code: l.Code, URL: l.URL, Clicks: l.Clicks, CreatedAt: l.CreatedAt})
+	}
+	return results
+}
+
+// sortedLinks orders links by before, then created_at DESC, then code ASC,
+// matching the SQL backends. before must report whether a sorts first on
+// its own key; returning false for both orders falls through to the rest.
+func (s *Store) sortedLinks(before func(a, b *link) bool) []*link {
+	sorted := make([]*link, 0, len(s.links))
+	for _, l := range s.links {
+		sorted = append(sorted, l)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if before(a, b) {
+			return true
+		}
+		if before(b, a) {
+			return false
+		}
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt > b.CreatedAt
+		}
+		return a.Code < b.Code
+	})
+	return sorted
+}
+
+func (s *Store) CreateAPIKey(ctx context.Context, key store.APIKey) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.keys {
+		if k.Hash == key.Hash {
+			return 0, errors.New("api key hash already exists")
+		}
+	}
+	if key.CreatedAt == 0 {
+		key.CreatedAt = time.Now().Unix()
+	}
+	key.ID = int64(len(s.keys) + 1)
+	key.RevokedAt = 0
+	key.Scopes = append([]string(nil), key.Scopes...)
+	s.keys = append(s.keys, key)
+	return key.ID, nil
+}
+
+func (s *Store) LookupAPIKey(ctx context.Context, hash string) (store.APIKey, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.keys {
+		if k.Hash == hash && k.RevokedAt == 0 {
+			return copyKey(k), true, nil
+		}
+	}
+	return store.APIKey{}, false, nil
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context) ([]store.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]store.APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		results = append(results, copyKey(k))
+	}
+	return results, nil
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.keys {
+		if s.keys[i].ID == id && s.keys[i].RevokedAt == 0 {
+			s.keys[i].RevokedAt = time.Now().Unix()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) CreateWebhook(ctx context.Context, hook store.Webhook) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if hook.CreatedAt == 0 {
+		hook.CreatedAt = time.Now().Unix()
+	}
+	s.hookSeq++
+	hook.ID = s.hookSeq
+	hook.Events = append([]string(nil), hook.Events...)
+	s.webhooks = append(s.webhooks, hook)
+	return hook.ID, nil
+}
+
+func (s *Store) ListWebhooks(ctx context.Context) ([]store.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]store.Webhook, 0, len(s.webhooks))
+	for _, hook := range s.webhooks {
+		hook.Events = append([]string(nil), hook.Events...)
+		results = append(results, hook)
+	}
+	return results, nil
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, hook := range s.webhooks {
+		if hook.ID == id {
+			s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) RecordDeadLetter(ctx context.Context, letter store.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if letter.FailedAt == 0 {
+		letter.FailedAt = time.Now().Unix()
+	}
+	letter.ID = int64(len(s.letters) + 1)
+	letter.Payload = append([]byte(nil), letter.Payload...)
+	s.letters = append(s.letters, letter)
+	return nil
+}
+
+func (s *Store) ListDeadLetters(ctx context.Context, limit int) ([]store.DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sorted := append([]store.DeadLetter(nil), s.letters...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].FailedAt != sorted[j].FailedAt {
+			return sorted[i].FailedAt > sorted[j].FailedAt
+		}
+		return sorted[i].ID > sorted[j].ID
+	})
+	results := []store.DeadLetter{}
+	for i := 0; i < len(sorted) && len(results) < limit; i++ {
+		results = append(results, sorted[i])
+	}
+	return results, nil
+}
+
+func (s *Store) CreateReport(ctx context.Context, report store.Report) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.links[report.Code]; !ok {
+		return 0, false, nil
+	}
+	if report.CreatedAt == 0 {
+		report.CreatedAt = time.Now().Unix()
+	}
+	s.reportSeq++
+	report.ID = s.reportSeq
+	s.reports = append(s.reports, report)
+
+	ips := make(map[string]struct{})
+	for _, r := range s.reports {
+		if r.Code == report.Code {
+			ips[r.IP] = struct{}{}
+		}
+	}
+	return int64(len(ips)), true, nil
+}
+
+func (s *Store) ListReports(ctx context.Context, code string, limit int) ([]store.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sorted []store.Report
+	for _, r := range s.reports {
+		if code == "" || r.Code == code {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].CreatedAt != sorted[j].CreatedAt {
+			return sorted[i].CreatedAt > sorted[j].CreatedAt
+		}
+		return sorted[i].ID > sorted[j].ID
+	})
+	results := []store.Report{}
+	for i := 0; i < len(sorted) && len(results) < limit; i++ {
+		results = append(results, sorted[i])
+	}
+	return results, nil
+}
+
+func (s *Store) ClearReports(ctx context.Context, code string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before := len(s.reports)
+	s.reports = slices.DeleteFunc(s.reports, func(r store.Report) bool { return r.Code == code })
+	return int64(before - len(s.reports)), nil
+}
+
+func (s *Store) SetQuarantined(ctx context.Context, code string, quarantined bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.links[code]
+	if !ok {
+		return false, nil
+	}
+	l.Quarantined = quarantined
+	return true, nil
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+func copyKey(k store.APIKey) store.APIKey {
+	k.Scopes = append([]string(nil), k.Scopes...)
+	return k
+}
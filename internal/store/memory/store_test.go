@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/store/storetest"
+)
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return New()
+	})
+}
+
+func TestStoreConcurrentCreateDedupes(t *testing.T) {
+	s := New()
+
+	var wg sync.WaitGroup
+	codes := make([]string, 20)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			code, err := s.CreateShortURL(t.Context(), "http://example.com")
+			if err != nil {
+				t.Errorf("create short url: %v", err)
+			}
+			codes[i] = code
+		}(i)
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		if code != codes[0] {
+			t.Fatalf("expected every concurrent create to share %s, got %s", codes[0], code)
+		}
+	}
+}
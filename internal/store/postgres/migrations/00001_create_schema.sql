@@ -0,0 +1,41 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS urls (
+  code TEXT PRIMARY KEY,
+  url TEXT NOT NULL,
+  created_at BIGINT NOT NULL,
+  clicks BIGINT NOT NULL DEFAULT 0,
+  custom BOOLEAN NOT NULL DEFAULT FALSE,
+  expires_at BIGINT,
+  max_clicks BIGINT,
+  notes TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_urls_created_at ON urls(created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_unique_url ON urls(url) WHERE NOT custom;
+
+CREATE TABLE IF NOT EXISTS clicks (
+  id BIGSERIAL PRIMARY KEY,
+  code TEXT NOT NULL,
+  clicked_at BIGINT NOT NULL,
+  referrer TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  ip TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_clicks_code_clicked_at ON clicks(code, clicked_at);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash TEXT NOT NULL UNIQUE,
+  scopes TEXT NOT NULL,
+  created_at BIGINT NOT NULL,
+  revoked_at BIGINT
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS api_keys;
+DROP INDEX IF EXISTS idx_clicks_code_clicked_at;
+DROP TABLE IF EXISTS clicks;
+DROP INDEX IF EXISTS idx_urls_unique_url;
+DROP INDEX IF EXISTS idx_urls_created_at;
+DROP TABLE IF EXISTS urls;
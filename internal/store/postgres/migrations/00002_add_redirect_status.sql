@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN redirect_status INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE urls DROP COLUMN redirect_status;
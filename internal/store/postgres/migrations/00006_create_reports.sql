@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN quarantined BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS reports (
+  id BIGSERIAL PRIMARY KEY,
+  code TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  details TEXT NOT NULL DEFAULT '',
+  ip TEXT NOT NULL DEFAULT '',
+  created_at BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_reports_code ON reports(code);
+CREATE INDEX IF NOT EXISTS idx_reports_created_at ON reports(created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS reports;
+ALTER TABLE urls DROP COLUMN quarantined;
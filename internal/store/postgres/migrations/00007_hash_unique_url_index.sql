@@ -0,0 +1,9 @@
+-- +goose Up
+-- A btree entry can't exceed about 2.7 KB, so index a hash of the URL
+-- instead of the URL itself.
+DROP INDEX IF EXISTS idx_urls_unique_url;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_unique_url_md5 ON urls(md5(url)) WHERE NOT custom;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_urls_unique_url_md5;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_unique_url ON urls(url) WHERE NOT custom;
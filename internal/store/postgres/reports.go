@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+)
+
+func (s *Store) CreateReport(ctx context.Context, report store.Report) (int64, bool, error) {
+	if report.CreatedAt == 0 {
+		report.CreatedAt = time.Now().Unix()
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO reports(code, reason, details, ip, created_at)
+		SELECT code, $1, $2, $3, $4::BIGINT FROM urls WHERE code = $5`,
+		report.Reason, report.Details, report.IP, report.CreatedAt, report.Code)
+	if err != nil {
+		return 0, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return 0, false, err
+	}
+	var reporters int64
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(DISTINCT ip) FROM reports WHERE code = $1`, report.Code).Scan(&reporters); err != nil {
+		return 0, false, err
+	}
+	return reporters, true, tx.Commit()
+}
+
+func (s *Store) ListReports(ctx context.Context, code string, limit int) ([]store.Report, error) {
+	if limit <= 0 {
+		return []store.Report{}, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, code, reason, details, ip, created_at FROM reports
+		WHERE $1 = '' OR code = $1 ORDER BY created_at DESC, id DESC LIMIT $2`, code, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []store.Report{}
+	for rows.Next() {
+		var report store.Report
+		if err := rows.Scan(&report.ID, &report.Code, &report.Reason, &report.Details, &report.IP, &report.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *Store) ClearReports(ctx context.Context, code string) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM reports WHERE code = $1`, code)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *Store) SetQuarantined(ctx context.Context, code string, quarantined bool) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE urls SET quarantined = $1 WHERE code = $2`, quarantined, code)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,409 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/util"
+)
+
+const (
+	shortCodeLen = 6
+	maxAttempts  = 8
+
+	uniqueViolation = "23505"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+var _ store.Store = (*Store)(nil)
+
+// Open connects to the database at url (a postgres:// URL or DSN) and
+// applies pending migrations.
+func Open(url string) (*Store, error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	if err := runMigrations(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) CreateShortURL(ctx context.Context, originalURL string) (string, error) {
+	return s.CreateShortURLWithOptions(ctx, originalURL, store.CreateOptions{})
+}
+
+func (s *Store) CreateShortURLWithOptions(ctx context.Context, originalURL string, opts store.CreateOptions) (string, error) {
+	if opts.Alias != "" {
+		return s.createAlias(ctx, originalURL, opts)
+	}
+
+	custom := opts.Custom()
+	var existing string
+	if !custom {
+		if err := s.db.QueryRowContext(ctx, `SELECT code FROM urls WHERE md5(url) = md5($1) AND url = $1 AND NOT custom`, originalURL).Scan(&existing); err == nil {
+			return existing, nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+	}
+
+	for i := 0; i < maxAttempts; i++ {
+		code, err := util.RandomCode(shortCodeLen)
+		if err != nil {
+			return "", err
+		}
+		if store.IsReservedCode(code) {
+			continue
+		}
+
+		_, err = s.db.ExecContext(ctx, `INSERT INTO urls(code, url, created_at, custom, expires_at, max_clicks, redirect_status, passthrough, password_hash) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			code, originalURL, time.Now().Unix(), custom, nullInt(opts.ExpiresAt), nullInt(opts.MaxClicks), opts.RedirectStatus, opts.Passthrough, opts.PasswordHash)
+		if err == nil {
+			return code, nil
+		}
+
+		if isConstraintError(err) {
+			if custom {
+				continue
+			}
+			if err := s.db.QueryRowContext(ctx, `SELECT code FROM urls WHERE md5(url) = md5($1) AND url = $1 AND NOT custom`, originalURL).Scan(&existing); err == nil {
+				return existing, nil
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return "", err
+			}
+			continue
+		}
+
+		return "", err
+	}
+
+	return "", fmt.Errorf("failed to generate unique short code after %d attempts", maxAttempts)
+}
+
+func (s *Store) createAlias(ctx context.Context, originalURL string, opts store.CreateOptions) (string, error) {
+	if err := store.ValidateAlias(opts.Alias); err != nil {
+		return "", err
+	}
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO urls(code, url, created_at, custom, expires_at, max_clicks, redirect_status, passthrough, password_hash) VALUES($1, $2, $3, TRUE, $4, $5, $6, $7, $8)`,
+		opts.Alias, originalURL, time.Now().Unix(), nullInt(opts.ExpiresAt), nullInt(opts.MaxClicks), opts.RedirectStatus, opts.Passthrough, opts.PasswordHash)
+	if err == nil {
+		return opts.Alias, nil
+	}
+	if !isConstraintError(err) {
+		return "", err
+	}
+
+	// Retrying the same alias for the same URL is not a conflict.
+	var existing string
+	if err := s.db.QueryRowContext(ctx, `SELECT url FROM urls WHERE code = $1`, opts.Alias).Scan(&existing); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", store.ErrCodeTaken
+		}
+		return "", err
+	}
+	if existing == originalURL {
+		return opts.Alias, nil
+	}
+	return "", store.ErrCodeTaken
+}
+
+func (s *Store) ResolveShortURL(ctx context.Context, code string) (store.Link, bool, error) {
+	link, err := scanLink(s.db.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM urls WHERE code = $1`, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.Link{}, false, nil
+		}
+		return store.Link{}, false, err
+	}
+
+	// The expiry and click budget are checked in the same statement that
+	// counts the click so concurrent redirects can't overspend max_clicks.
+	res, err := s.db.ExecContext(ctx, `UPDATE urls SET clicks = clicks + 1
+		WHERE code = $1
+		AND (expires_at IS NULL OR expires_at > $2)
+		AND (max_clicks IS NULL OR clicks < max_clicks)`, code, time.Now().Unix())
+	if err != nil {
+		return store.Link{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return store.Link{}, false, err
+	} else if n == 0 {
+		return store.Link{}, true, store.ErrLinkExpired
+	}
+	link.Clicks++
+	return link, true, nil
+}
+
+const linkColumns = `code, url, clicks, created_at, expires_at, max_clicks, notes, redirect_status, passthrough, password_hash, quarantined`
+
+func (s *Store) GetLink(ctx context.Context, code string) (store.Link, bool, error) {
+	link, err := scanLink(s.db.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM urls WHERE code = $1`, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.Link{}, false, nil
+		}
+		return store.Link{}, false, err
+	}
+	return link, true, nil
+}
+
+func (s *Store) ListLinks(ctx context.Context, offset, limit int) ([]store.Link, error) {
+	if limit <= 0 {
+		return []store.Link{}, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+linkColumns+` FROM urls ORDER BY created_at DESC, code COLLATE "C" ASC LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []store.Link{}
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *Store) UpdateLink(ctx context.Context, code string, update store.LinkUpdate) (store.Link, bool, error) {
+	sets := []string{"custom = TRUE"}
+	var args []any
+	set := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if update.URL != nil {
+		set("url", *update.URL)
+	}
+	if update.ExpiresAt != nil {
+		set("expires_at", nullInt(*update.ExpiresAt))
+	}
+	if update.MaxClicks != nil {
+		set("max_clicks", nullInt(*update.MaxClicks))
+	}
+	if update.Notes != nil {
+		set("notes", *update.Notes)
+	}
+	if update.RedirectStatus != nil {
+		set("redirect_status", *update.RedirectStatus)
+	}
+	if update.Passthrough != nil {
+		set("passthrough", *update.Passthrough)
+	}
+	if update.PasswordHash != nil {
+		set("password_hash", *update.PasswordHash)
+	}
+	args = append(args, code)
+
+	query := fmt.Sprintf(`UPDATE urls SET %s WHERE code = $%d`, strings.Join(sets, ", "), len(args))
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return store.Link{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return store.Link{}, false, err
+	} else if n == 0 {
+		return store.Link{}, false, nil
+	}
+	return s.GetLink(ctx, code)
+}
+
+func (s *Store) DeleteLink(ctx context.Context, code string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM urls WHERE code = $1`, code)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM clicks WHERE code = $1`, code); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM reports WHERE code = $1`, code); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(row rowScanner) (store.Link, error) {
+	var (
+		link      store.Link
+		expiresAt sql.NullInt64
+		maxClicks sql.NullInt64
+	)
+	if err := row.Scan(&link.Code, &link.URL, &link.Clicks, &link.CreatedAt, &expiresAt, &maxClicks, &link.Notes, &link.RedirectStatus, &link.Passthrough, &link.PasswordHash, &link.Quarantined); err != nil {
+		return store.Link{}, err
+	}
+	link.ExpiresAt = expiresAt.Int64
+	link.MaxClicks = maxClicks.Int64
+	return link, nil
+}
+
+func (s *Store) RecordClick(ctx context.Context, code string, click store.Click) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO clicks(code, clicked_at, referrer, user_agent, ip) VALUES($1, $2, $3, $4, $5)`,
+		code, click.At, click.Referrer, click.UserAgent, click.IP)
+	return err
+}
+
+func (s *Store) ClickTimeseries(ctx context.Context, code string, bucketSeconds, from, to int64) ([]store.TimeBucket, bool, error) {
+	if bucketSeconds <= 0 {
+		return nil, false, fmt.Errorf("invalid bucket width %d", bucketSeconds)
+	}
+
+	var exists int
+	if err := s.db.QueryRowContext(ctx, `SELECT 1 FROM urls WHERE code = $1`, code).Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT (clicked_at / $1) * $1 AS bucket, COUNT(*)
+		FROM clicks
+		WHERE code = $2 AND clicked_at >= $3 AND clicked_at < $4
+		GROUP BY bucket
+		ORDER BY bucket`, bucketSeconds, code, from, to)
+	if err != nil {
+		return nil, true, err
+	}
+	defer rows.Close()
+
+	results := []store.TimeBucket{}
+	for rows.Next() {
+		var bucket store.TimeBucket
+		if err := rows.Scan(&bucket.Start, &bucket.Clicks); err != nil {
+			return nil, true, err
+		}
+		results = append(results, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, true, err
+	}
+	return results, true, nil
+}
+
+// Size reports the database size in bytes.
+func (s *Store) Size(ctx context.Context) (int64, error) {
+	var size int64
+	err := s.db.QueryRowContext(ctx, `SELECT pg_database_size(current_database())`).Scan(&size)
+	return size, err
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return err
+	}
+	return checkSchema(ctx, s.db)
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func nullInt(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
+func isConstraintError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == uniqueViolation
+	}
+	return false
+}
+
+func (s *Store) Summary(ctx context.Context) (store.Summary, error) {
+	var summary store.Summary
+	row := s.db.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(clicks), 0)::BIGINT FROM urls`)
+	if err := row.Scan(&summary.TotalURLs, &summary.TotalClicks); err != nil {
+		return store.Summary{}, err
+	}
+	return summary, nil
+}
+
+func (s *Store) Top(ctx context.Context, limit int) ([]store.LinkInfo, error) {
+	if limit <= 0 {
+		return []store.LinkInfo{}, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT code, url, clicks, created_at FROM urls ORDER BY clicks DESC, created_at DESC, code COLLATE "C" ASC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []store.LinkInfo
+	for rows.Next() {
+		var info store.LinkInfo
+		if err := rows.Scan(&info.Code, &info.URL, &info.Clicks, &info.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *Store) Recent(ctx context.Context, limit int) ([]store.LinkInfo, error) {
+	if limit <= 0 {
+		return []store.LinkInfo{}, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT code, url, clicks, created_at FROM urls ORDER BY created_at DESC, code COLLATE "C" ASC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []store.LinkInfo
+	for rows.Next() {
+		var info store.LinkInfo
+		if err := rows.Scan(&info.Code, &info.URL, &info.Clicks, &info.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/store/storetest"
+)
+
+// openTestStore opens a store in a fresh schema of the database named by
+// SHORTSLUG_TEST_POSTGRES_URL, skipping the test when it isn't set.
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	base := os.Getenv("SHORTSLUG_TEST_POSTGRES_URL")
+	if base == "" {
+		t.Skip("SHORTSLUG_TEST_POSTGRES_URL not set")
+	}
+
+	admin, err := sql.Open("pgx", base)
+	if err != nil {
+		t.Fatalf("open admin connection: %v", err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+
+	schema := fmt.Sprintf("shortslug_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { _, _ = admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatalf("parse url: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	store, err := Open(u.String())
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func TestStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return openTestStore(t)
+	})
+}
+
+func TestStoreCreateResolveAndAnalytics(t *testing.T) {
+	store := openTestStore(t)
+
+	code, err := store.CreateShortURL(t.Context(), "http://example.com")
+	if err != nil {
+		t.Fatalf("create short url: %v", err)
+	}
+	code2, err := store.CreateShortURL(t.Context(), "http://example.com")
+	if err != nil {
+		t.Fatalf("create short url again: %v", err)
+	}
+	if code2 != code {
+		t.Fatalf("expected same code for same url, got %s vs %s", code, code2)
+	}
+
+	link, ok, err := store.ResolveShortURL(t.Context(), code)
+	if err != nil {
+		t.Fatalf("resolve short url: %v", err)
+	}
+	if !ok {
+		t.Fatalf("expected url to resolve")
+	}
+	if link.URL != "http://example.com" {
+		t.Fatalf("unexpected url: %s", link.URL)
+	}
+
+	summary, err := store.Summary(t.Context())
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if summary.TotalURLs != 1 || summary.TotalClicks != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	top, err := store.Top(t.Context(), 5)
+	if err != nil {
+		t.Fatalf("top: %v", err)
+	}
+	if len(top) != 1 || top[0].Code != code {
+		t.Fatalf("unexpected top results")
+	}
+}
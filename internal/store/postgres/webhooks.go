@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+)
+
+func (s *Store) CreateWebhook(ctx context.Context, hook store.Webhook) (int64, error) {
+	if hook.CreatedAt == 0 {
+		hook.CreatedAt = time.Now().Unix()
+	}
+	var id int64
+	err := s.db.QueryRowContext(ctx, `INSERT INTO webhooks(url, secret, events, created_at) VALUES($1, $2, $3, $4) RETURNING id`,
+		hook.URL, hook.Secret, strings.Join(hook.Events, " "), hook.CreatedAt).Scan(&id)
+	return id, err
+}
+
+func (s *Store) ListWebhooks(ctx context.Context) ([]store.Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, url, secret, events, created_at FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []store.Webhook{}
+	for rows.Next() {
+		var (
+			hook   store.Webhook
+			events string
+		)
+		if err := rows.Scan(&hook.ID, &hook.URL, &hook.Secret, &events, &hook.CreatedAt); err != nil {
+			return nil, err
+		}
+		hook.Events = strings.Fields(events)
+		results = append(results, hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, id int64) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *Store) RecordDeadLetter(ctx context.Context, letter store.DeadLetter) error {
+	if letter.FailedAt == 0 {
+		letter.FailedAt = time.Now().Unix()
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO webhook_dead_letters(webhook_id, event, payload, error, attempts, failed_at) VALUES($1, $2, $3, $4, $5, $6)`,
+		letter.WebhookID, letter.Event, string(letter.Payload), letter.Error, letter.Attempts, letter.FailedAt)
+	return err
+}
+
+func (s *Store) ListDeadLetters(ctx context.Context, limit int) ([]store.DeadLetter, error) {
+	if limit <= 0 {
+		return []store.DeadLetter{}, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT id, webhook_id, event, payload, error, attempts, failed_at
+		FROM webhook_dead_letters ORDER BY failed_at DESC, id DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []store.DeadLetter{}
+	for rows.Next() {
+		var (
+			letter  store.DeadLetter
+			payload string
+		)
+		if err := rows.Scan(&letter.ID, &letter.WebhookID, &letter.Event, &payload, &letter.Error, &letter.Attempts, &letter.FailedAt); err != nil {
+			return nil, err
+		}
+		letter.Payload = []byte(payload)
+		results = append(results, letter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
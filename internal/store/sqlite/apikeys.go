@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+)
+
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, created_at, revoked_at`
+
+func (s *Store) CreateAPIKey(ctx context.Context, key store.APIKey) (int64, error) {
+	if key.CreatedAt == 0 {
+		key.CreatedAt = time.Now().Unix()
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO api_keys(name, prefix, key_hash, scopes, created_at) VALUES(?, ?, ?, ?, ?)`,
+		key.Name, key.Prefix, key.Hash, strings.Join(key.Scopes, " "), key.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *Store) LookupAPIKey(ctx context.Context, hash string) (store.APIKey, bool, error) {
+	key, err := scanAPIKey(s.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL`, hash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.APIKey{}, false, nil
+		}
+		return store.APIKey{}, false, err
+	}
+	return key, true, nil
+}
+
+func (s *Store) ListAPIKeys(ctx context.Context) ([]store.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []store.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, id int64) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now().Unix(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func scanAPIKey(row rowScanner) (store.APIKey, error) {
+	var (
+		key       store.APIKey
+		scopes    string
+		revokedAt sql.NullInt64
+	)
+	if err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash, &scopes, &key.CreatedAt, &revokedAt); err != nil {
+		return store.APIKey{}, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.RevokedAt = revokedAt.Int64
+	return key, nil
+}
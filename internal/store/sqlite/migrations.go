@@ -1,8 +1,12 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"embed"
+	"fmt"
+	"io/fs"
+	"path"
 
 	"github.com/pressly/goose/v3"
 )
@@ -17,3 +21,29 @@ func runMigrations(db *sql.DB) error {
 	}
 	return goose.Up(db, "migrations")
 }
+
+// checkSchema fails unless every embedded migration has been applied, so a
+// replica never serves against a schema older than its code expects.
+func checkSchema(ctx context.Context, db *sql.DB) error {
+	names, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	var want int64
+	for _, name := range names {
+		version, err := goose.NumericComponent(path.Base(name))
+		if err != nil {
+			return err
+		}
+		want = max(want, version)
+	}
+
+	var have int64
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied`).Scan(&have); err != nil {
+		return err
+	}
+	if have < want {
+		return fmt.Errorf("database schema is at version %d, want %d", have, want)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN custom INTEGER NOT NULL DEFAULT 0;
+DROP INDEX IF EXISTS idx_urls_unique_url;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_unique_url ON urls(url) WHERE custom = 0;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_urls_unique_url;
+DELETE FROM urls
+WHERE rowid NOT IN (
+  SELECT MIN(rowid)
+  FROM urls
+  GROUP BY url
+);
+ALTER TABLE urls DROP COLUMN custom;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_unique_url ON urls(url);
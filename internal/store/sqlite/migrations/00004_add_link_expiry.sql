@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN expires_at INTEGER;
+ALTER TABLE urls ADD COLUMN max_clicks INTEGER;
+
+-- +goose Down
+ALTER TABLE urls DROP COLUMN max_clicks;
+ALTER TABLE urls DROP COLUMN expires_at;
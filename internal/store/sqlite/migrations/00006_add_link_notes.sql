@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE urls DROP COLUMN notes;
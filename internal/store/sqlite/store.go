@@ -1,9 +1,11 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mattn/go-sqlite3"
@@ -28,6 +30,10 @@ func Open(path string) (*Store, error) {
 	if err != nil {
 		return nil, err
 	}
+	if path == ":memory:" {
+		// Every connection would otherwise get its own empty database.
+		db.SetMaxOpenConns(1)
+	}
 
 	if err := db.Ping(); err != nil {
 		_ = db.Close()
@@ -42,15 +48,26 @@ func Open(path string) (*Store, error) {
 	return &Store{db: db}, nil
 }
 
-func (s *Store) CreateShortURL(originalURL string) (string, error) {
+func (s *Store) CreateShortURL(ctx context.Context, originalURL string) (string, error) {
+	return s.CreateShortURLWithOptions(ctx, originalURL, store.CreateOptions{})
+}
+
+func (s *Store) CreateShortURLWithOptions(ctx context.Context, originalURL string, opts store.CreateOptions) (string, error) {
+	if opts.Alias != "" {
+		return s.createAlias(ctx, originalURL, opts)
+	}
+
+	custom := opts.Custom()
 	var existing string
-	if err := s.db.QueryRow(`SELECT code FROM urls WHERE url = ?`, originalURL).Scan(&existing); err == nil {
-		return existing, nil
-	} else if !errors.Is(err, sql.ErrNoRows) {
-		return "", err
+	if !custom {
+		if err := s.db.QueryRowContext(ctx, `SELECT code FROM urls WHERE url = ? AND custom = 0`, originalURL).Scan(&existing); err == nil {
+			return existing, nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
 	}
 
-	stmt, err := s.db.Prepare(`INSERT INTO urls(code, url, created_at) VALUES(?, ?, ?)`)
+	stmt, err := s.db.PrepareContext(ctx, `INSERT INTO urls(code, url, created_at, custom, expires_at, max_clicks, redirect_status, passthrough, password_hash) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return "", err
 	}
@@ -61,14 +78,20 @@ func (s *Store) CreateShortURL(originalURL string) (string, error) {
 		if err != nil {
 			return "", err
 		}
+		if store.IsReservedCode(code) {
+			continue
+		}
 
-		_, err = stmt.Exec(code, originalURL, time.Now().Unix())
+		_, err = stmt.ExecContext(ctx, code, originalURL, time.Now().Unix(), custom, nullInt(opts.ExpiresAt), nullInt(opts.MaxClicks), opts.RedirectStatus, opts.Passthrough, opts.PasswordHash)
 		if err == nil {
 			return code, nil
 		}
 
 		if isConstraintError(err) {
-			if err := s.db.QueryRow(`SELECT code FROM urls WHERE url = ?`, originalURL).Scan(&existing); err == nil {
+			if custom {
+				continue
+			}
+			if err := s.db.QueryRowContext(ctx, `SELECT code FROM urls WHERE url = ? AND custom = 0`, originalURL).Scan(&existing); err == nil {
 				return existing, nil
 			} else if !errors.Is(err, sql.ErrNoRows) {
 				return "", err
@@ -82,24 +105,250 @@ func (s *Store) CreateShortURL(originalURL string) (string, error) {
 	return "", fmt.Errorf("failed to generate unique short code after %d attempts", maxAttempts)
 }
 
-func (s *Store) ResolveShortURL(code string) (string, bool, error) {
-	var url string
-	row := s.db.QueryRow(`SELECT url FROM urls WHERE code = ?`, code)
-	if err := row.Scan(&url); err != nil {
+func (s *Store) createAlias(ctx context.Context, originalURL string, opts store.CreateOptions) (string, error) {
+	if err := store.ValidateAlias(opts.Alias); err != nil {
+		return "", err
+	}
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO urls(code, url, created_at, custom, expires_at, max_clicks, redirect_status, passthrough, password_hash) VALUES(?, ?, ?, 1, ?, ?, ?, ?, ?)`,
+		opts.Alias, originalURL, time.Now().Unix(), nullInt(opts.ExpiresAt), nullInt(opts.MaxClicks), opts.RedirectStatus, opts.Passthrough, opts.PasswordHash)
+	if err == nil {
+		return opts.Alias, nil
+	}
+	if !isConstraintError(err) {
+		return "", err
+	}
+
+	// Retrying the same alias for the same URL is not a conflict.
+	var existing string
+	if err := s.db.QueryRowContext(ctx, `SELECT url FROM urls WHERE code = ?`, opts.Alias).Scan(&existing); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", store.ErrCodeTaken
+		}
+		return "", err
+	}
+	if existing == originalURL {
+		return opts.Alias, nil
+	}
+	return "", store.ErrCodeTaken
+}
+
+func (s *Store) ResolveShortURL(ctx context.Context, code string) (store.Link, bool, error) {
+	link, err := scanLink(s.db.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM urls WHERE code = ?`, code))
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", false, nil
+			return store.Link{}, false, nil
 		}
-		return "", false, err
+		return store.Link{}, false, err
 	}
 
-	_, _ = s.db.Exec(`UPDATE urls SET clicks = clicks + 1 WHERE code = ?`, code)
-	return url, true, nil
+	// The expiry and click budget are checked in the same statement that
+	// counts the click so concurrent redirects can't overspend max_clicks.
+	res, err := s.db.ExecContext(ctx, `UPDATE urls SET clicks = clicks + 1
+		WHERE code = ?
+		AND (expires_at IS NULL OR expires_at > ?)
+		AND (max_clicks IS NULL OR clicks < max_clicks)`, code, time.Now().Unix())
+	if err != nil {
+		return store.Link{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return store.Link{}, false, err
+	} else if n == 0 {
+		return store.Link{}, true, store.ErrLinkExpired
+	}
+	link.Clicks++
+	return link, true, nil
+}
+
+const linkColumns = `code, url, clicks, created_at, expires_at, max_clicks, notes, redirect_status, passthrough, password_hash, quarantined`
+
+func (s *Store) GetLink(ctx context.Context, code string) (store.Link, bool, error) {
+	link, err := scanLink(s.db.QueryRowContext(ctx, `SELECT `+linkColumns+` FROM urls WHERE code = ?`, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.Link{}, false, nil
+		}
+		return store.Link{}, false, err
+	}
+	return link, true, nil
+}
+
+func (s *Store) ListLinks(ctx context.Context, offset, limit int) ([]store.Link, error) {
+	if limit <= 0 {
+		return []store.Link{}, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+linkColumns+` FROM urls ORDER BY created_at DESC, code ASC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []store.Link{}
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *Store) UpdateLink(ctx context.Context, code string, update store.LinkUpdate) (store.Link, bool, error) {
+	sets := []string{"custom = 1"}
+	var args []any
+	if update.URL != nil {
+		sets = append(sets, "url = ?")
+		args = append(args, *update.URL)
+	}
+	if update.ExpiresAt != nil {
+		sets = append(sets, "expires_at = ?")
+		args = append(args, nullInt(*update.ExpiresAt))
+	}
+	if update.MaxClicks != nil {
+		sets = append(sets, "max_clicks = ?")
+		args = append(args, nullInt(*update.MaxClicks))
+	}
+	if update.Notes != nil {
+		sets = append(sets, "notes = ?")
+		args = append(args, *update.Notes)
+	}
+	if update.RedirectStatus != nil {
+		sets = append(sets, "redirect_status = ?")
+		args = append(args, *update.RedirectStatus)
+	}
+	if update.Passthrough != nil {
+		sets = append(sets, "passthrough = ?")
+		args = append(args, *update.Passthrough)
+	}
+	if update.PasswordHash != nil {
+		sets = append(sets, "password_hash = ?")
+		args = append(args, *update.PasswordHash)
+	}
+	args = append(args, code)
+
+	res, err := s.db.ExecContext(ctx, `UPDATE urls SET `+strings.Join(sets, ", ")+` WHERE code = ?`, args...)
+	if err != nil {
+		return store.Link{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return store.Link{}, false, err
+	} else if n == 0 {
+		return store.Link{}, false, nil
+	}
+	return s.GetLink(ctx, code)
+}
+
+func (s *Store) DeleteLink(ctx context.Context, code string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM urls WHERE code = ?`, code)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM clicks WHERE code = ?`, code); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM reports WHERE code = ?`, code); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(row rowScanner) (store.Link, error) {
+	var (
+		link      store.Link
+		expiresAt sql.NullInt64
+		maxClicks sql.NullInt64
+	)
+	if err := row.Scan(&link.Code, &link.URL, &link.Clicks, &link.CreatedAt, &expiresAt, &maxClicks, &link.Notes, &link.RedirectStatus, &link.Passthrough, &link.PasswordHash, &link.Quarantined); err != nil {
+		return store.Link{}, err
+	}
+	link.ExpiresAt = expiresAt.Int64
+	link.MaxClicks = maxClicks.Int64
+	return link, nil
+}
+
+func (s *Store) RecordClick(ctx context.Context, code string, click store.Click) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO clicks(code, clicked_at, referrer, user_agent, ip) VALUES(?, ?, ?, ?, ?)`,
+		code, click.At, click.Referrer, click.UserAgent, click.IP)
+	return err
+}
+
+func (s *Store) ClickTimeseries(ctx context.Context, code string, bucketSeconds, from, to int64) ([]store.TimeBucket, bool, error) {
+	if bucketSeconds <= 0 {
+		return nil, false, fmt.Errorf("invalid bucket width %d", bucketSeconds)
+	}
+
+	var exists int
+	if err := s.db.QueryRowContext(ctx, `SELECT 1 FROM urls WHERE code = ?`, code).Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT (clicked_at / ?) * ? AS bucket, COUNT(*)
+		FROM clicks
+		WHERE code = ? AND clicked_at >= ? AND clicked_at < ?
+		GROUP BY bucket
+		ORDER BY bucket`, bucketSeconds, bucketSeconds, code, from, to)
+	if err != nil {
+		return nil, true, err
+	}
+	defer rows.Close()
+
+	results := []store.TimeBucket{}
+	for rows.Next() {
+		var bucket store.TimeBucket
+		if err := rows.Scan(&bucket.Start, &bucket.Clicks); err != nil {
+			return nil, true, err
+		}
+		results = append(results, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, true, err
+	}
+	return results, true, nil
+}
+
+// Size reports the database size in bytes.
+func (s *Store) Size(ctx context.Context) (int64, error) {
+	var size int64
+	err := s.db.QueryRowContext(ctx, `SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()`).Scan(&size)
+	return size, err
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return err
+	}
+	return checkSchema(ctx, s.db)
 }
 
 func (s *Store) Close() error {
 	return s.db.Close()
 }
 
+func nullInt(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
+
 func isConstraintError(err error) bool {
 	var sqliteErr sqlite3.Error
 	if errors.As(err, &sqliteErr) {
@@ -108,20 +357,20 @@ func isConstraintError(err error) bool {
 	return false
 }
 
-func (s *Store) Summary() (store.Summary, error) {
+func (s *Store) Summary(ctx context.Context) (store.Summary, error) {
 	var summary store.Summary
-	row := s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(clicks), 0) FROM urls`)
+	row := s.db.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(SUM(clicks), 0) FROM urls`)
 	if err := row.Scan(&summary.TotalURLs, &summary.TotalClicks); err != nil {
 		return store.Summary{}, err
 	}
 	return summary, nil
 }
 
-func (s *Store) Top(limit int) ([]store.LinkInfo, error) {
+func (s *Store) Top(ctx context.Context, limit int) ([]store.LinkInfo, error) {
 	if limit <= 0 {
 		return []store.LinkInfo{}, nil
 	}
-	rows, err := s.db.Query(`SELECT code, url, clicks, created_at FROM urls ORDER BY clicks DESC, created_at DESC LIMIT ?`, limit)
+	rows, err := s.db.QueryContext(ctx, `SELECT code, url, clicks, created_at FROM urls ORDER BY clicks DESC, created_at DESC, code ASC LIMIT ?`, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -141,11 +390,11 @@ func (s *Store) Top(limit int) ([]store.LinkInfo, error) {
 	return results, nil
 }
 
-func (s *Store) Recent(limit int) ([]store.LinkInfo, error) {
+func (s *Store) Recent(ctx context.Context, limit int) ([]store.LinkInfo, error) {
 	if limit <= 0 {
 		return []store.LinkInfo{}, nil
 	}
-	rows, err := s.db.Query(`SELECT code, url, clicks, created_at FROM urls ORDER BY created_at DESC LIMIT ?`, limit)
+	rows, err := s.db.QueryContext(ctx, `SELECT code, url, clicks, created_at FROM urls ORDER BY created_at DESC, code ASC LIMIT ?`, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -1,10 +1,37 @@
 package sqlite
 
 import (
+	"context"
+	"errors"
 	"path/filepath"
 	"testing"
+	"time"
+
+	shortstore "github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/store/storetest"
 )
 
+func TestStoreConformance(t *testing.T) {
+	t.Run("File", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) shortstore.Store {
+			store, err := Open(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("open store: %v", err)
+			}
+			return store
+		})
+	})
+	t.Run("Memory", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) shortstore.Store {
+			store, err := Open(":memory:")
+			if err != nil {
+				t.Fatalf("open store: %v", err)
+			}
+			return store
+		})
+	})
+}
+
 func TestStoreCreateResolveAndAnalytics(t *testing.T) {
 	store, err := Open(filepath.Join(t.TempDir(), "test.db"))
 	if err != nil {
@@ -12,11 +39,11 @@ func TestStoreCreateResolveAndAnalytics(t *testing.T) {
 	}
 	t.Cleanup(func() { _ = store.Close() })
 
-	code, err := store.CreateShortURL("http://example.com")
+	code, err := store.CreateShortURL(t.Context(), "http://example.com")
 	if err != nil {
 		t.Fatalf("create short url: %v", err)
 	}
-	code2, err := store.CreateShortURL("http://example.com")
+	code2, err := store.CreateShortURL(t.Context(), "http://example.com")
 	if err != nil {
 		t.Fatalf("create short url again: %v", err)
 	}
@@ -24,18 +51,18 @@ func TestStoreCreateResolveAndAnalytics(t *testing.T) {
 		t.Fatalf("expected same code for same url, got %s vs %s", code, code2)
 	}
 
-	url, ok, err := store.ResolveShortURL(code)
+	link, ok, err := store.ResolveShortURL(t.Context(), code)
 	if err != nil {
 		t.Fatalf("resolve short url: %v", err)
 	}
 	if !ok {
 		t.Fatalf("expected url to resolve")
 	}
-	if url != "http://example.com" {
-		t.Fatalf("unexpected url: %s", url)
+	if link.URL != "http://example.com" {
+		t.Fatalf("unexpected url: %s", link.URL)
 	}
 
-	summary, err := store.Summary()
+	summary, err := store.Summary(t.Context())
 	if err != nil {
 		t.Fatalf("summary: %v", err)
 	}
@@ -46,7 +73,7 @@ func TestStoreCreateResolveAndAnalytics(t *testing.T) {
 		t.Fatalf("expected 1 click, got %d", summary.TotalClicks)
 	}
 
-	top, err := store.Top(5)
+	top, err := store.Top(t.Context(), 5)
 	if err != nil {
 		t.Fatalf("top: %v", err)
 	}
@@ -54,7 +81,7 @@ func TestStoreCreateResolveAndAnalytics(t *testing.T) {
 		t.Fatalf("unexpected top results")
 	}
 
-	recent, err := store.Recent(5)
+	recent, err := store.Recent(t.Context(), 5)
 	if err != nil {
 		t.Fatalf("recent: %v", err)
 	}
@@ -62,3 +89,311 @@ func TestStoreCreateResolveAndAnalytics(t *testing.T) {
 		t.Fatalf("unexpected recent results")
 	}
 }
+
+func TestStoreAliases(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	random, err := store.CreateShortURL(t.Context(), "http://example.com")
+	if err != nil {
+		t.Fatalf("create short url: %v", err)
+	}
+
+	code, err := store.CreateShortURLWithOptions(t.Context(), "http://example.com", shortstore.CreateOptions{Alias: "q3-roadmap"})
+	if err != nil {
+		t.Fatalf("create alias: %v", err)
+	}
+	if code != "q3-roadmap" {
+		t.Fatalf("expected alias code, got %s", code)
+	}
+
+	again, err := store.CreateShortURL(t.Context(), "http://example.com")
+	if err != nil {
+		t.Fatalf("create short url again: %v", err)
+	}
+	if again != random {
+		t.Fatalf("expected plain link to keep reusing %s, got %s", random, again)
+	}
+
+	if _, err := store.CreateShortURLWithOptions(t.Context(), "http://example.com", shortstore.CreateOptions{Alias: "q3-roadmap"}); err != nil {
+		t.Fatalf("expected repeated alias for same url to succeed: %v", err)
+	}
+	if _, err := store.CreateShortURLWithOptions(t.Context(), "http://other.example.com", shortstore.CreateOptions{Alias: "q3-roadmap"}); !errors.Is(err, shortstore.ErrCodeTaken) {
+		t.Fatalf("expected ErrCodeTaken, got %v", err)
+	}
+	if _, err := store.CreateShortURLWithOptions(t.Context(), "http://example.com", shortstore.CreateOptions{Alias: "API"}); !errors.Is(err, shortstore.ErrReservedCode) {
+		t.Fatalf("expected ErrReservedCode, got %v", err)
+	}
+	if _, err := store.CreateShortURLWithOptions(t.Context(), "http://example.com", shortstore.CreateOptions{Alias: "bad/alias"}); !errors.Is(err, shortstore.ErrInvalidCode) {
+		t.Fatalf("expected ErrInvalidCode, got %v", err)
+	}
+
+	link, ok, err := store.ResolveShortURL(t.Context(), "q3-roadmap")
+	if err != nil || !ok || link.URL != "http://example.com" {
+		t.Fatalf("unexpected alias resolution: %q %v %v", link.URL, ok, err)
+	}
+}
+
+func TestStoreExpiry(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	plain, err := store.CreateShortURL(t.Context(), "http://example.com")
+	if err != nil {
+		t.Fatalf("create short url: %v", err)
+	}
+
+	once, err := store.CreateShortURLWithOptions(t.Context(), "http://example.com", shortstore.CreateOptions{MaxClicks: 1})
+	if err != nil {
+		t.Fatalf("create one-time link: %v", err)
+	}
+	if once == plain {
+		t.Fatalf("expected one-time link to get its own code")
+	}
+	if _, _, err := store.ResolveShortURL(t.Context(), once); err != nil {
+		t.Fatalf("first resolve: %v", err)
+	}
+	if _, ok, err := store.ResolveShortURL(t.Context(), once); !ok || !errors.Is(err, shortstore.ErrLinkExpired) {
+		t.Fatalf("expected exhausted link to report ErrLinkExpired, got %v %v", ok, err)
+	}
+
+	past, err := store.CreateShortURLWithOptions(t.Context(), "http://example.com", shortstore.CreateOptions{ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("create expired link: %v", err)
+	}
+	if _, ok, err := store.ResolveShortURL(t.Context(), past); !ok || !errors.Is(err, shortstore.ErrLinkExpired) {
+		t.Fatalf("expected expired link to report ErrLinkExpired, got %v %v", ok, err)
+	}
+
+	if _, _, err := store.ResolveShortURL(t.Context(), plain); err != nil {
+		t.Fatalf("plain link should still resolve: %v", err)
+	}
+}
+
+func TestStoreRecordClick(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	code, err := store.CreateShortURL(t.Context(), "http://example.com")
+	if err != nil {
+		t.Fatalf("create short url: %v", err)
+	}
+
+	click := shortstore.Click{At: 1700000000, Referrer: "https://news.example", UserAgent: "test-agent", IP: "203.0.113.0"}
+	if err := store.RecordClick(t.Context(), code, click); err != nil {
+		t.Fatalf("record click: %v", err)
+	}
+
+	var got shortstore.Click
+	row := store.db.QueryRow(`SELECT clicked_at, referrer, user_agent, ip FROM clicks WHERE code = ?`, code)
+	if err := row.Scan(&got.At, &got.Referrer, &got.UserAgent, &got.IP); err != nil {
+		t.Fatalf("scan click: %v", err)
+	}
+	if got != click {
+		t.Fatalf("unexpected click row: %+v", got)
+	}
+}
+
+func TestStoreClickTimeseries(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	code, err := store.CreateShortURL(t.Context(), "http://example.com")
+	if err != nil {
+		t.Fatalf("create short url: %v", err)
+	}
+	for _, at := range []int64{3600, 3700, 7300, 20000} {
+		if err := store.RecordClick(t.Context(), code, shortstore.Click{At: at}); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	buckets, ok, err := store.ClickTimeseries(t.Context(), code, 3600, 0, 10800)
+	if err != nil || !ok {
+		t.Fatalf("timeseries: %v %v", ok, err)
+	}
+	want := []shortstore.TimeBucket{{Start: 3600, Clicks: 2}, {Start: 7200, Clicks: 1}}
+	if len(buckets) != len(want) {
+		t.Fatalf("expected %d buckets, got %+v", len(want), buckets)
+	}
+	for i := range want {
+		if buckets[i] != want[i] {
+			t.Fatalf("bucket %d: expected %+v, got %+v", i, want[i], buckets[i])
+		}
+	}
+
+	if _, ok, err := store.ClickTimeseries(t.Context(), "missing", 3600, 0, 10800); err != nil || ok {
+		t.Fatalf("expected unknown code to report !ok, got %v %v", ok, err)
+	}
+}
+
+func TestStoreLinkManagement(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	code, err := store.CreateShortURL(t.Context(), "http://exmaple.com")
+	if err != nil {
+		t.Fatalf("create short url: %v", err)
+	}
+	if err := store.RecordClick(t.Context(), code, shortstore.Click{At: 1}); err != nil {
+		t.Fatalf("record click: %v", err)
+	}
+
+	fixed := "http://example.com"
+	notes := "printed on flyers"
+	link, ok, err := store.UpdateLink(t.Context(), code, shortstore.LinkUpdate{URL: &fixed, Notes: &notes})
+	if err != nil || !ok {
+		t.Fatalf("update link: %v %v", ok, err)
+	}
+	if link.URL != fixed || link.Notes != notes || link.Code != code {
+		t.Fatalf("unexpected updated link: %+v", link)
+	}
+
+	fresh, err := store.CreateShortURL(t.Context(), "http://example.com")
+	if err != nil {
+		t.Fatalf("create after edit: %v", err)
+	}
+	if fresh == code {
+		t.Fatalf("expected edited link to leave the dedupe pool")
+	}
+
+	links, err := store.ListLinks(t.Context(), 0, 10)
+	if err != nil {
+		t.Fatalf("list links: %v", err)
+	}
+	if len(links) != 2 {
+		t.Fatalf("expected 2 links, got %d", len(links))
+	}
+	page, err := store.ListLinks(t.Context(), 1, 10)
+	if err != nil {
+		t.Fatalf("list second page: %v", err)
+	}
+	if len(page) != 1 || page[0].Code != links[1].Code {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+
+	deleted, err := store.DeleteLink(t.Context(), code)
+	if err != nil || !deleted {
+		t.Fatalf("delete link: %v %v", deleted, err)
+	}
+	if _, ok, err := store.GetLink(t.Context(), code); err != nil || ok {
+		t.Fatalf("expected deleted link to be gone, got %v %v", ok, err)
+	}
+	var clicks int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM clicks WHERE code = ?`, code).Scan(&clicks); err != nil || clicks != 0 {
+		t.Fatalf("expected click history to be removed, got %d %v", clicks, err)
+	}
+	if deleted, err := store.DeleteLink(t.Context(), code); err != nil || deleted {
+		t.Fatalf("expected second delete to report missing, got %v %v", deleted, err)
+	}
+}
+
+func TestStoreAPIKeys(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	id, err := store.CreateAPIKey(t.Context(), shortstore.APIKey{Name: "ci", Prefix: "ss_abc", Hash: "deadbeef", Scopes: []string{"links:write", "analytics:read"}})
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	key, ok, err := store.LookupAPIKey(t.Context(), "deadbeef")
+	if err != nil || !ok {
+		t.Fatalf("lookup api key: %v %v", ok, err)
+	}
+	if key.ID != id || key.Name != "ci" || len(key.Scopes) != 2 || key.Scopes[1] != "analytics:read" {
+		t.Fatalf("unexpected key: %+v", key)
+	}
+
+	revoked, err := store.RevokeAPIKey(t.Context(), id)
+	if err != nil || !revoked {
+		t.Fatalf("revoke api key: %v %v", revoked, err)
+	}
+	if _, ok, err := store.LookupAPIKey(t.Context(), "deadbeef"); err != nil || ok {
+		t.Fatalf("expected revoked key to be rejected, got %v %v", ok, err)
+	}
+	if again, err := store.RevokeAPIKey(t.Context(), id); err != nil || again {
+		t.Fatalf("expected second revoke to be a no-op, got %v %v", again, err)
+	}
+
+	keys, err := store.ListAPIKeys(t.Context())
+	if err != nil {
+		t.Fatalf("list api keys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].RevokedAt == 0 {
+		t.Fatalf("expected revoked key in listing, got %+v", keys)
+	}
+}
+
+func TestStoreHonorsContextCancellation(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if _, err := store.CreateShortURL(ctx, "http://example.com"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected create to fail with context.Canceled, got %v", err)
+	}
+	if _, _, err := store.ResolveShortURL(ctx, "abc123"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected resolve to fail with context.Canceled, got %v", err)
+	}
+	if _, err := store.Summary(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected summary to fail with context.Canceled, got %v", err)
+	}
+}
+
+func TestStoreSize(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	size, err := store.Size(t.Context())
+	if err != nil {
+		t.Fatalf("size: %v", err)
+	}
+	if size <= 0 {
+		t.Fatalf("expected a positive size, got %d", size)
+	}
+}
+
+func TestPingReportsPendingMigrations(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	if err := store.Ping(t.Context()); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if _, err := store.db.ExecContext(t.Context(), `DELETE FROM goose_db_version WHERE version_id = (SELECT MAX(version_id) FROM goose_db_version)`); err != nil {
+		t.Fatalf("forget latest migration: %v", err)
+	}
+	if err := store.Ping(t.Context()); err == nil {
+		t.Fatalf("expected ping to fail with a migration missing")
+	}
+}
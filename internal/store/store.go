@@ -1,10 +1,53 @@
 package store
 
+import "context"
+
 type Store interface {
-	CreateShortURL(originalURL string) (string, error)
-	ResolveShortURL(code string) (string, bool, error)
-	Summary() (Summary, error)
-	Top(limit int) ([]LinkInfo, error)
-	Recent(limit int) ([]LinkInfo, error)
+	CreateShortURL(ctx context.Context, originalURL string) (string, error)
+	CreateShortURLWithOptions(ctx context.Context, originalURL string, opts CreateOptions) (string, error)
+	// ResolveShortURL counts a click and returns the link, including the new
+	// click. Links past their expiry or click budget report ok with
+	// ErrLinkExpired.
+	ResolveShortURL(ctx context.Context, code string) (Link, bool, error)
+	GetLink(ctx context.Context, code string) (Link, bool, error)
+	ListLinks(ctx context.Context, offset, limit int) ([]Link, error)
+	// UpdateLink applies update and returns the new record. Edited links are
+	// no longer reused by CreateShortURL for the same destination.
+	UpdateLink(ctx context.Context, code string, update LinkUpdate) (Link, bool, error)
+	// DeleteLink removes the link, its click history and its reports.
+	DeleteLink(ctx context.Context, code string) (bool, error)
+	RecordClick(ctx context.Context, code string, click Click) error
+	// ClickTimeseries returns the non-empty buckets of bucketSeconds width
+	// in [from, to), ordered by start. ok is false for unknown codes.
+	ClickTimeseries(ctx context.Context, code string, bucketSeconds, from, to int64) ([]TimeBucket, bool, error)
+	Summary(ctx context.Context) (Summary, error)
+	Top(ctx context.Context, limit int) ([]LinkInfo, error)
+	Recent(ctx context.Context, limit int) ([]LinkInfo, error)
+	CreateAPIKey(ctx context.Context, key APIKey) (int64, error)
+	// LookupAPIKey finds an unrevoked key by hash.
+	LookupAPIKey(ctx context.Context, hash string) (APIKey, bool, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int64) (bool, error)
+	CreateWebhook(ctx context.Context, hook Webhook) (int64, error)
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64) (bool, error)
+	RecordDeadLetter(ctx context.Context, letter DeadLetter) error
+	// ListDeadLetters returns the most recent failed deliveries first.
+	ListDeadLetters(ctx context.Context, limit int) ([]DeadLetter, error)
+	// CreateReport records a report and returns how many distinct IPs have
+	// reported the link. ok is false for unknown codes.
+	CreateReport(ctx context.Context, report Report) (reporters int64, ok bool, err error)
+	// ListReports returns the most recent reports first, for every link
+	// when code is empty.
+	ListReports(ctx context.Context, code string, limit int) ([]Report, error)
+	// ClearReports deletes a link's reports and returns how many there were.
+	ClearReports(ctx context.Context, code string) (int64, error)
+	// SetQuarantined changes whether a link is quarantined. Unlike
+	// UpdateLink it leaves the link shareable by CreateShortURL, so
+	// shortening the same URL again doesn't escape the quarantine.
+	SetQuarantined(ctx context.Context, code string, quarantined bool) (bool, error)
+	// Ping reports an error when the store is unreachable or its schema is
+	// missing migrations.
+	Ping(ctx context.Context) error
 	Close() error
 }
@@ -0,0 +1,698 @@
+// Package storetest is a conformance suite for store.Store implementations.
+// Backends call Run from their own tests so every implementation is held to
+// the same behavior contract.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+)
+
+// Run exercises s against the store.Store contract. open must return an
+// empty store; it is called once per subtest and the store is closed when
+// the subtest finishes.
+func Run(t *testing.T, open func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"DedupeIdenticalURL", testDedupeIdenticalURL},
+		{"DistinctURLsGetDistinctCodes", testDistinctURLs},
+		{"LongURL", testLongURL},
+		{"AliasCollisions", testAliasCollisions},
+		{"AliasValidation", testAliasValidation},
+		{"ResolveCountsClicks", testResolveCountsClicks},
+		{"UnknownCode", testUnknownCode},
+		{"Expiry", testExpiry},
+		{"ClickBudget", testClickBudget},
+		{"RedirectStatus", testRedirectStatus},
+		{"Passthrough", testPassthrough},
+		{"PasswordHash", testPasswordHash},
+		{"TopOrderingTies", testTopOrdering},
+		{"RecentOrdering", testRecentOrdering},
+		{"LimitZero", testLimitZero},
+		{"SummaryEmpty", testSummaryEmpty},
+		{"Summary", testSummary},
+		{"ClickTimeseries", testClickTimeseries},
+		{"LinkManagement", testLinkManagement},
+		{"ListLinksPagination", testListLinksPagination},
+		{"APIKeys", testAPIKeys},
+		{"Webhooks", testWebhooks},
+		{"DeadLetters", testDeadLetters},
+		{"Reports", testReports},
+		{"Quarantine", testQuarantine},
+		{"Ping", testPing},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := open(t)
+			t.Cleanup(func() { _ = s.Close() })
+			tc.fn(t, s)
+		})
+	}
+}
+
+func mustCreate(t *testing.T, s store.Store, url string) string {
+	t.Helper()
+	code, err := s.CreateShortURL(t.Context(), url)
+	if err != nil {
+		t.Fatalf("create %s: %v", url, err)
+	}
+	return code
+}
+
+func mustResolve(t *testing.T, s store.Store, code string, times int) {
+	t.Helper()
+	for i := 0; i < times; i++ {
+		if _, ok, err := s.ResolveShortURL(t.Context(), code); err != nil || !ok {
+			t.Fatalf("resolve %s: %v %v", code, ok, err)
+		}
+	}
+}
+
+func testDedupeIdenticalURL(t *testing.T, s store.Store) {
+	code := mustCreate(t, s, "http://example.com")
+	if again := mustCreate(t, s, "http://example.com"); again != code {
+		t.Fatalf("expected identical URL to reuse %s, got %s", code, again)
+	}
+
+	custom, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com", store.CreateOptions{MaxClicks: 5})
+	if err != nil {
+		t.Fatalf("create custom link: %v", err)
+	}
+	if custom == code {
+		t.Fatalf("expected link with options to get its own code")
+	}
+	if again := mustCreate(t, s, "http://example.com"); again != code {
+		t.Fatalf("expected plain link to keep reusing %s after a custom link, got %s", code, again)
+	}
+}
+
+// testLongURL covers URLs longer than a database index entry may be.
+func testLongURL(t *testing.T, s store.Store) {
+	long := "https://example.com/?q=" + strings.Repeat("a", 16<<10)
+	code := mustCreate(t, s, long)
+	if again := mustCreate(t, s, long); again != code {
+		t.Fatalf("expected the long URL to reuse %s, got %s", code, again)
+	}
+	link, ok, err := s.GetLink(t.Context(), code)
+	if err != nil || !ok || link.URL != long {
+		t.Fatalf("expected the long URL back: %v %v", ok, err)
+	}
+}
+
+func testDistinctURLs(t *testing.T, s store.Store) {
+	seen := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		url := fmt.Sprintf("http://example.com/%d", i)
+		code := mustCreate(t, s, url)
+		if prev, ok := seen[code]; ok {
+			t.Fatalf("code %s issued for both %s and %s", code, prev, url)
+		}
+		if store.IsReservedCode(code) {
+			t.Fatalf("generated reserved code %s", code)
+		}
+		seen[code] = url
+	}
+}
+
+func testAliasCollisions(t *testing.T, s store.Store) {
+	random := mustCreate(t, s, "http://example.com/random")
+
+	if _, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com/other", store.CreateOptions{Alias: random}); !errors.Is(err, store.ErrCodeTaken) {
+		t.Fatalf("expected alias matching a random code to be taken, got %v", err)
+	}
+
+	code, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com/deck", store.CreateOptions{Alias: "q3-roadmap"})
+	if err != nil || code != "q3-roadmap" {
+		t.Fatalf("create alias: %q %v", code, err)
+	}
+	if _, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com/deck", store.CreateOptions{Alias: "q3-roadmap"}); err != nil {
+		t.Fatalf("expected repeated alias for the same URL to succeed, got %v", err)
+	}
+	if _, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com/elsewhere", store.CreateOptions{Alias: "q3-roadmap"}); !errors.Is(err, store.ErrCodeTaken) {
+		t.Fatalf("expected ErrCodeTaken, got %v", err)
+	}
+
+	link, ok, err := s.ResolveShortURL(t.Context(), "q3-roadmap")
+	if err != nil || !ok || link.URL != "http://example.com/deck" {
+		t.Fatalf("unexpected alias resolution: %q %v %v", link.URL, ok, err)
+	}
+}
+
+func testAliasValidation(t *testing.T, s store.Store) {
+	cases := map[string]error{
+		"API":       store.ErrReservedCode,
+		"healthz":   store.ErrReservedCode,
+		"bad/alias": store.ErrInvalidCode,
+		"-leading":  store.ErrInvalidCode,
+		"has space": store.ErrInvalidCode,
+	}
+	for alias, want := range cases {
+		if _, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com", store.CreateOptions{Alias: alias}); !errors.Is(err, want) {
+			t.Fatalf("alias %q: expected %v, got %v", alias, want, err)
+		}
+	}
+}
+
+func testResolveCountsClicks(t *testing.T, s store.Store) {
+	code := mustCreate(t, s, "http://example.com")
+	resolved, ok, err := s.ResolveShortURL(t.Context(), code)
+	if err != nil || !ok || resolved.URL != "http://example.com" || resolved.Clicks != 1 {
+		t.Fatalf("unexpected resolution: %+v %v %v", resolved, ok, err)
+	}
+	mustResolve(t, s, code, 2)
+
+	link, ok, err := s.GetLink(t.Context(), code)
+	if err != nil || !ok {
+		t.Fatalf("get link: %v %v", ok, err)
+	}
+	if link.Clicks != 3 {
+		t.Fatalf("expected 3 clicks, got %d", link.Clicks)
+	}
+}
+
+func testUnknownCode(t *testing.T, s store.Store) {
+	if link, ok, err := s.ResolveShortURL(t.Context(), "missing"); err != nil || ok || link.URL != "" {
+		t.Fatalf("resolve unknown: %q %v %v", link.URL, ok, err)
+	}
+	if _, ok, err := s.GetLink(t.Context(), "missing"); err != nil || ok {
+		t.Fatalf("get unknown: %v %v", ok, err)
+	}
+	notes := "x"
+	if _, ok, err := s.UpdateLink(t.Context(), "missing", store.LinkUpdate{Notes: &notes}); err != nil || ok {
+		t.Fatalf("update unknown: %v %v", ok, err)
+	}
+	if ok, err := s.DeleteLink(t.Context(), "missing"); err != nil || ok {
+		t.Fatalf("delete unknown: %v %v", ok, err)
+	}
+	if _, ok, err := s.ClickTimeseries(t.Context(), "missing", 3600, 0, 3600); err != nil || ok {
+		t.Fatalf("timeseries unknown: %v %v", ok, err)
+	}
+}
+
+func testExpiry(t *testing.T, s store.Store) {
+	past, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com", store.CreateOptions{ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("create expired link: %v", err)
+	}
+	if _, ok, err := s.ResolveShortURL(t.Context(), past); !ok || !errors.Is(err, store.ErrLinkExpired) {
+		t.Fatalf("expected ErrLinkExpired, got %v %v", ok, err)
+	}
+
+	future, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com", store.CreateOptions{ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("create future link: %v", err)
+	}
+	mustResolve(t, s, future, 1)
+}
+
+func testClickBudget(t *testing.T, s store.Store) {
+	code, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com", store.CreateOptions{MaxClicks: 2})
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	mustResolve(t, s, code, 2)
+	if _, ok, err := s.ResolveShortURL(t.Context(), code); !ok || !errors.Is(err, store.ErrLinkExpired) {
+		t.Fatalf("expected spent budget to report ErrLinkExpired, got %v %v", ok, err)
+	}
+
+	link, _, err := s.GetLink(t.Context(), code)
+	if err != nil {
+		t.Fatalf("get link: %v", err)
+	}
+	if link.Clicks != 2 {
+		t.Fatalf("expected rejected redirects not to count, got %d clicks", link.Clicks)
+	}
+}
+
+func testRedirectStatus(t *testing.T, s store.Store) {
+	plain := mustCreate(t, s, "http://example.com")
+	code, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com", store.CreateOptions{RedirectStatus: 302})
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if code == plain {
+		t.Fatalf("expected link with a redirect status to get its own code")
+	}
+
+	link, ok, err := s.ResolveShortURL(t.Context(), code)
+	if err != nil || !ok || link.RedirectStatus != 302 {
+		t.Fatalf("unexpected resolution: %+v %v %v", link, ok, err)
+	}
+
+	status := 0
+	link, ok, err = s.UpdateLink(t.Context(), code, store.LinkUpdate{RedirectStatus: &status})
+	if err != nil || !ok || link.RedirectStatus != 0 {
+		t.Fatalf("clear redirect status: %+v %v %v", link, ok, err)
+	}
+	status = 307
+	if link, _, err = s.UpdateLink(t.Context(), plain, store.LinkUpdate{RedirectStatus: &status}); err != nil || link.RedirectStatus != 307 {
+		t.Fatalf("set redirect status: %+v %v", link, err)
+	}
+}
+
+func testPassthrough(t *testing.T, s store.Store) {
+	plain := mustCreate(t, s, "http://example.com/docs")
+	code, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com/docs", store.CreateOptions{Passthrough: true})
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if code == plain {
+		t.Fatalf("expected passthrough link to get its own code")
+	}
+	if link, _, err := s.GetLink(t.Context(), code); err != nil || !link.Passthrough {
+		t.Fatalf("expected passthrough to be stored: %+v %v", link, err)
+	}
+
+	off := false
+	if link, ok, err := s.UpdateLink(t.Context(), code, store.LinkUpdate{Passthrough: &off}); err != nil || !ok || link.Passthrough {
+		t.Fatalf("disable passthrough: %+v %v %v", link, ok, err)
+	}
+}
+
+func testPasswordHash(t *testing.T, s store.Store) {
+	plain := mustCreate(t, s, "http://example.com/handbook")
+	code, err := s.CreateShortURLWithOptions(t.Context(), "http://example.com/handbook", store.CreateOptions{PasswordHash: "$2a$10$hash"})
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if code == plain {
+		t.Fatalf("expected protected link to get its own code")
+	}
+	if again := mustCreate(t, s, "http://example.com/handbook"); again != plain {
+		t.Fatalf("expected plain link to keep reusing %s, got %s", plain, again)
+	}
+
+	link, ok, err := s.ResolveShortURL(t.Context(), code)
+	if err != nil || !ok || link.PasswordHash != "$2a$10$hash" {
+		t.Fatalf("unexpected resolution: %+v %v %v", link, ok, err)
+	}
+
+	cleared := ""
+	if link, ok, err := s.UpdateLink(t.Context(), code, store.LinkUpdate{PasswordHash: &cleared}); err != nil || !ok || link.PasswordHash != "" {
+		t.Fatalf("clear password: %+v %v %v", link, ok, err)
+	}
+}
+
+func testTopOrdering(t *testing.T, s store.Store) {
+	a := mustCreate(t, s, "http://example.com/a")
+	b := mustCreate(t, s, "http://example.com/b")
+	c := mustCreate(t, s, "http://example.com/c")
+	d := mustCreate(t, s, "http://example.com/d")
+	mustResolve(t, s, a, 1)
+	mustResolve(t, s, b, 3)
+	mustResolve(t, s, c, 1)
+	mustResolve(t, s, d, 1)
+
+	top, err := s.Top(t.Context(), 10)
+	if err != nil {
+		t.Fatalf("top: %v", err)
+	}
+	if len(top) != 4 || top[0].Code != b {
+		t.Fatalf("expected %s first, got %+v", b, top)
+	}
+	assertOrdered(t, top[1:], true)
+
+	limited, err := s.Top(t.Context(), 2)
+	if err != nil {
+		t.Fatalf("top limited: %v", err)
+	}
+	if len(limited) != 2 || limited[0] != top[0] || limited[1] != top[1] {
+		t.Fatalf("expected limit to truncate the same ordering, got %+v", limited)
+	}
+}
+
+func testRecentOrdering(t *testing.T, s store.Store) {
+	for i := 0; i < 5; i++ {
+		mustCreate(t, s, fmt.Sprintf("http://example.com/%d", i))
+	}
+	recent, err := s.Recent(t.Context(), 10)
+	if err != nil {
+		t.Fatalf("recent: %v", err)
+	}
+	if len(recent) != 5 {
+		t.Fatalf("expected 5 links, got %d", len(recent))
+	}
+	assertOrdered(t, recent, false)
+}
+
+// assertOrdered checks clicks DESC (when byClicks), then created_at DESC,
+// then code ASC.
+func assertOrdered(t *testing.T, links []store.LinkInfo, byClicks bool) {
+	t.Helper()
+	for i := 1; i < len(links); i++ {
+		prev, cur := links[i-1], links[i]
+		switch {
+		case byClicks && prev.Clicks != cur.Clicks:
+			if prev.Clicks < cur.Clicks {
+				t.Fatalf("clicks out of order at %d: %+v", i, links)
+			}
+		case prev.CreatedAt != cur.CreatedAt:
+			if prev.CreatedAt < cur.CreatedAt {
+				t.Fatalf("created_at out of order at %d: %+v", i, links)
+			}
+		case prev.Code >= cur.Code:
+			t.Fatalf("tie not broken by code at %d: %+v", i, links)
+		}
+	}
+}
+
+func testLimitZero(t *testing.T, s store.Store) {
+	mustCreate(t, s, "http://example.com")
+	if top, err := s.Top(t.Context(), 0); err != nil || len(top) != 0 {
+		t.Fatalf("top(0): %v %v", top, err)
+	}
+	if recent, err := s.Recent(t.Context(), 0); err != nil || len(recent) != 0 {
+		t.Fatalf("recent(0): %v %v", recent, err)
+	}
+	if links, err := s.ListLinks(t.Context(), 0, 0); err != nil || len(links) != 0 {
+		t.Fatalf("list(0): %v %v", links, err)
+	}
+}
+
+func testSummaryEmpty(t *testing.T, s store.Store) {
+	summary, err := s.Summary(t.Context())
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if summary != (store.Summary{}) {
+		t.Fatalf("expected zero summary, got %+v", summary)
+	}
+	if top, err := s.Top(t.Context(), 5); err != nil || len(top) != 0 {
+		t.Fatalf("top on empty store: %v %v", top, err)
+	}
+	if recent, err := s.Recent(t.Context(), 5); err != nil || len(recent) != 0 {
+		t.Fatalf("recent on empty store: %v %v", recent, err)
+	}
+}
+
+func testSummary(t *testing.T, s store.Store) {
+	a := mustCreate(t, s, "http://example.com/a")
+	mustCreate(t, s, "http://example.com/b")
+	mustResolve(t, s, a, 3)
+
+	summary, err := s.Summary(t.Context())
+	if err != nil {
+		t.Fatalf("summary: %v", err)
+	}
+	if summary.TotalURLs != 2 || summary.TotalClicks != 3 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+}
+
+func testClickTimeseries(t *testing.T, s store.Store) {
+	code := mustCreate(t, s, "http://example.com")
+	other := mustCreate(t, s, "http://example.com/other")
+	for _, at := range []int64{3600, 3700, 7300, 20000} {
+		if err := s.RecordClick(t.Context(), code, store.Click{At: at, Referrer: "https://ref.example", UserAgent: "ua", IP: "203.0.113.0"}); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+	if err := s.RecordClick(t.Context(), other, store.Click{At: 3600}); err != nil {
+		t.Fatalf("record click: %v", err)
+	}
+
+	buckets, ok, err := s.ClickTimeseries(t.Context(), code, 3600, 0, 10800)
+	if err != nil || !ok {
+		t.Fatalf("timeseries: %v %v", ok, err)
+	}
+	want := []store.TimeBucket{{Start: 3600, Clicks: 2}, {Start: 7200, Clicks: 1}}
+	if len(buckets) != len(want) {
+		t.Fatalf("expected %v, got %v", want, buckets)
+	}
+	for i := range want {
+		if buckets[i] != want[i] {
+			t.Fatalf("bucket %d: expected %+v, got %+v", i, want[i], buckets[i])
+		}
+	}
+
+	empty, ok, err := s.ClickTimeseries(t.Context(), code, 3600, 100000, 200000)
+	if err != nil || !ok || len(empty) != 0 {
+		t.Fatalf("expected no buckets outside the range, got %v %v %v", empty, ok, err)
+	}
+}
+
+func testLinkManagement(t *testing.T, s store.Store) {
+	code := mustCreate(t, s, "http://exmaple.com")
+	if err := s.RecordClick(t.Context(), code, store.Click{At: 3600}); err != nil {
+		t.Fatalf("record click: %v", err)
+	}
+
+	fixed := "http://example.com"
+	notes := "printed on flyers"
+	expires := time.Now().Add(time.Hour).Unix()
+	maxClicks := int64(10)
+	link, ok, err := s.UpdateLink(t.Context(), code, store.LinkUpdate{URL: &fixed, Notes: &notes, ExpiresAt: &expires, MaxClicks: &maxClicks})
+	if err != nil || !ok {
+		t.Fatalf("update link: %v %v", ok, err)
+	}
+	if link.Code != code || link.URL != fixed || link.Notes != notes || link.ExpiresAt != expires || link.MaxClicks != maxClicks {
+		t.Fatalf("unexpected updated link: %+v", link)
+	}
+
+	zero := int64(0)
+	link, _, err = s.UpdateLink(t.Context(), code, store.LinkUpdate{ExpiresAt: &zero, MaxClicks: &zero})
+	if err != nil {
+		t.Fatalf("clear limits: %v", err)
+	}
+	if link.ExpiresAt != 0 || link.MaxClicks != 0 || link.Notes != notes {
+		t.Fatalf("expected limits cleared and notes kept, got %+v", link)
+	}
+
+	if fresh := mustCreate(t, s, fixed); fresh == code {
+		t.Fatalf("expected edited link to leave the dedupe pool")
+	}
+
+	deleted, err := s.DeleteLink(t.Context(), code)
+	if err != nil || !deleted {
+		t.Fatalf("delete: %v %v", deleted, err)
+	}
+	if _, ok, err := s.GetLink(t.Context(), code); err != nil || ok {
+		t.Fatalf("expected deleted link to be gone: %v %v", ok, err)
+	}
+	if _, ok, err := s.ClickTimeseries(t.Context(), code, 3600, 0, 7200); err != nil || ok {
+		t.Fatalf("expected deleted link's clicks to be gone: %v %v", ok, err)
+	}
+}
+
+func testListLinksPagination(t *testing.T, s store.Store) {
+	for i := 0; i < 5; i++ {
+		mustCreate(t, s, fmt.Sprintf("http://example.com/%d", i))
+	}
+
+	all, err := s.ListLinks(t.Context(), 0, 10)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(all) != 5 {
+		t.Fatalf("expected 5 links, got %d", len(all))
+	}
+
+	var paged []store.Link
+	for offset := 0; offset < 10; offset += 2 {
+		page, err := s.ListLinks(t.Context(), offset, 2)
+		if err != nil {
+			t.Fatalf("list page %d: %v", offset, err)
+		}
+		paged = append(paged, page...)
+	}
+	if len(paged) != len(all) {
+		t.Fatalf("expected pages to cover %d links, got %d", len(all), len(paged))
+	}
+	for i := range all {
+		if paged[i] != all[i] {
+			t.Fatalf("page order differs at %d: %+v vs %+v", i, paged[i], all[i])
+		}
+	}
+}
+
+func testAPIKeys(t *testing.T, s store.Store) {
+	id, err := s.CreateAPIKey(t.Context(), store.APIKey{Name: "ci", Prefix: "ss_abc", Hash: "hash-1", Scopes: []string{"links:write", "analytics:read"}})
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	if _, err := s.CreateAPIKey(t.Context(), store.APIKey{Name: "other", Prefix: "ss_def", Hash: "hash-2", Scopes: []string{"admin"}}); err != nil {
+		t.Fatalf("create second key: %v", err)
+	}
+
+	key, ok, err := s.LookupAPIKey(t.Context(), "hash-1")
+	if err != nil || !ok {
+		t.Fatalf("lookup: %v %v", ok, err)
+	}
+	if key.ID != id || key.Name != "ci" || key.Prefix != "ss_abc" || len(key.Scopes) != 2 || key.CreatedAt == 0 {
+		t.Fatalf("unexpected key: %+v", key)
+	}
+	if _, ok, err := s.LookupAPIKey(t.Context(), "nope"); err != nil || ok {
+		t.Fatalf("lookup unknown: %v %v", ok, err)
+	}
+
+	if revoked, err := s.RevokeAPIKey(t.Context(), id); err != nil || !revoked {
+		t.Fatalf("revoke: %v %v", revoked, err)
+	}
+	if _, ok, err := s.LookupAPIKey(t.Context(), "hash-1"); err != nil || ok {
+		t.Fatalf("expected revoked key to be hidden: %v %v", ok, err)
+	}
+	if again, err := s.RevokeAPIKey(t.Context(), id); err != nil || again {
+		t.Fatalf("expected second revoke to report false: %v %v", again, err)
+	}
+
+	keys, err := s.ListAPIKeys(t.Context())
+	if err != nil {
+		t.Fatalf("list keys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != id || keys[0].RevokedAt == 0 || keys[1].RevokedAt != 0 {
+		t.Fatalf("unexpected key listing: %+v", keys)
+	}
+}
+
+func testWebhooks(t *testing.T, s store.Store) {
+	id, err := s.CreateWebhook(t.Context(), store.Webhook{URL: "https://hooks.example.com/a", Secret: "s3cret", Events: []string{"link.created"}})
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	other, err := s.CreateWebhook(t.Context(), store.Webhook{URL: "https://hooks.example.com/b", Secret: "other"})
+	if err != nil {
+		t.Fatalf("create second webhook: %v", err)
+	}
+
+	hooks, err := s.ListWebhooks(t.Context())
+	if err != nil {
+		t.Fatalf("list webhooks: %v", err)
+	}
+	if len(hooks) != 2 || hooks[0].ID != id || hooks[0].Secret != "s3cret" || len(hooks[0].Events) != 1 || hooks[0].CreatedAt == 0 {
+		t.Fatalf("unexpected webhooks: %+v", hooks)
+	}
+	if hooks[1].ID != other || len(hooks[1].Events) != 0 {
+		t.Fatalf("expected second webhook to subscribe to everything: %+v", hooks[1])
+	}
+
+	if ok, err := s.DeleteWebhook(t.Context(), id); err != nil || !ok {
+		t.Fatalf("delete webhook: %v %v", ok, err)
+	}
+	if ok, err := s.DeleteWebhook(t.Context(), id); err != nil || ok {
+		t.Fatalf("expected second delete to report false: %v %v", ok, err)
+	}
+	if hooks, err := s.ListWebhooks(t.Context()); err != nil || len(hooks) != 1 {
+		t.Fatalf("expected one webhook left: %+v %v", hooks, err)
+	}
+}
+
+func testDeadLetters(t *testing.T, s store.Store) {
+	if letters, err := s.ListDeadLetters(t.Context(), 10); err != nil || len(letters) != 0 {
+		t.Fatalf("expected no dead letters: %+v %v", letters, err)
+	}
+	for i, event := range []string{"link.created", "link.clicked"} {
+		err := s.RecordDeadLetter(t.Context(), store.DeadLetter{
+			WebhookID: 7,
+			Event:     event,
+			Payload:   []byte(`{"type":"` + event + `"}`),
+			Error:     "status 500",
+			Attempts:  3,
+			FailedAt:  int64(1000 + i),
+		})
+		if err != nil {
+			t.Fatalf("record dead letter: %v", err)
+		}
+	}
+
+	letters, err := s.ListDeadLetters(t.Context(), 1)
+	if err != nil {
+		t.Fatalf("list dead letters: %v", err)
+	}
+	if len(letters) != 1 || letters[0].Event != "link.clicked" || string(letters[0].Payload) != `{"type":"link.clicked"}` || letters[0].Attempts != 3 || letters[0].WebhookID != 7 {
+		t.Fatalf("unexpected dead letters: %+v", letters)
+	}
+}
+
+func testReports(t *testing.T, s store.Store) {
+	code := mustCreate(t, s, "https://example.com/reported")
+	other := mustCreate(t, s, "https://example.com/other")
+
+	if _, ok, err := s.CreateReport(t.Context(), store.Report{Code: "missing", Reason: "spam"}); err != nil || ok {
+		t.Fatalf("expected a report for an unknown code to fail: %v %v", ok, err)
+	}
+	reports := []store.Report{
+		{Code: code, Reason: "phishing", IP: "192.0.2.0", CreatedAt: 1000},
+		{Code: code, Reason: "phishing", Details: "fake login page", IP: "192.0.2.0", CreatedAt: 1001},
+		{Code: other, Reason: "spam", IP: "198.51.100.0", CreatedAt: 1002},
+		{Code: code, Reason: "malware", IP: "203.0.113.0", CreatedAt: 1003},
+	}
+	var reporters int64
+	for _, report := range reports {
+		n, ok, err := s.CreateReport(t.Context(), report)
+		if err != nil || !ok {
+			t.Fatalf("create report: %v %v", ok, err)
+		}
+		if report.Code == code {
+			reporters = n
+		}
+	}
+	if reporters != 2 {
+		t.Fatalf("expected repeat reports from one IP to count once, got %d reporters", reporters)
+	}
+
+	all, err := s.ListReports(t.Context(), "", 10)
+	if err != nil {
+		t.Fatalf("list reports: %v", err)
+	}
+	if len(all) != 4 || all[0].Reason != "malware" || all[3].CreatedAt != 1000 {
+		t.Fatalf("expected every report, newest first: %+v", all)
+	}
+	own, err := s.ListReports(t.Context(), code, 2)
+	if err != nil {
+		t.Fatalf("list link reports: %v", err)
+	}
+	if len(own) != 2 || own[0].Code != code || own[1].Details != "fake login page" || own[1].ID == 0 {
+		t.Fatalf("unexpected link reports: %+v", own)
+	}
+
+	if n, err := s.ClearReports(t.Context(), code); err != nil || n != 3 {
+		t.Fatalf("expected 3 cleared reports: %d %v", n, err)
+	}
+	if left, err := s.ListReports(t.Context(), "", 10); err != nil || len(left) != 1 || left[0].Code != other {
+		t.Fatalf("expected only the other link's report left: %+v %v", left, err)
+	}
+
+	if _, err := s.DeleteLink(t.Context(), other); err != nil {
+		t.Fatalf("delete link: %v", err)
+	}
+	if left, err := s.ListReports(t.Context(), "", 10); err != nil || len(left) != 0 {
+		t.Fatalf("expected deleting a link to remove its reports: %+v %v", left, err)
+	}
+}
+
+func testQuarantine(t *testing.T, s store.Store) {
+	code := mustCreate(t, s, "https://example.com/quarantined")
+
+	if ok, err := s.SetQuarantined(t.Context(), code, true); err != nil || !ok {
+		t.Fatalf("quarantine: %v %v", ok, err)
+	}
+	if link, ok, err := s.GetLink(t.Context(), code); err != nil || !ok || !link.Quarantined {
+		t.Fatalf("expected the link to be quarantined: %+v %v", link, err)
+	}
+	if again := mustCreate(t, s, "https://example.com/quarantined"); again != code {
+		t.Fatalf("expected shortening the URL again to reuse the quarantined code, got %s", again)
+	}
+
+	if ok, err := s.SetQuarantined(t.Context(), code, false); err != nil || !ok {
+		t.Fatalf("release: %v %v", ok, err)
+	}
+	if link, _, _ := s.GetLink(t.Context(), code); link.Quarantined {
+		t.Fatalf("expected the link to be released")
+	}
+	if ok, err := s.SetQuarantined(t.Context(), "missing", true); err != nil || ok {
+		t.Fatalf("expected quarantining an unknown code to report false: %v %v", ok, err)
+	}
+}
+
+func testPing(t *testing.T, s store.Store) {
+	if err := s.Ping(t.Context()); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+}
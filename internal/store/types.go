@@ -1,5 +1,7 @@
 package store
 
+import "encoding/json"
+
 type LinkInfo struct {
 	Code      string `json:"code"`
 	URL       string `json:"url"`
@@ -7,7 +9,133 @@ type LinkInfo struct {
 	CreatedAt int64  `json:"created_at"`
 }
 
+// Link is the full record behind a short code as exposed by the management
+// API. ExpiresAt, MaxClicks and RedirectStatus are zero when unset.
+type Link struct {
+	Code           string `json:"code"`
+	URL            string `json:"url"`
+	Clicks         int64  `json:"clicks"`
+	CreatedAt      int64  `json:"created_at"`
+	ExpiresAt      int64  `json:"expires_at,omitempty"`
+	MaxClicks      int64  `json:"max_clicks,omitempty"`
+	Notes          string `json:"notes,omitempty"`
+	RedirectStatus int    `json:"redirect_status,omitempty"`
+	Passthrough    bool   `json:"passthrough,omitempty"`
+	// PasswordHash is a bcrypt hash visitors' passwords are checked
+	// against; empty for links anyone can follow.
+	PasswordHash string `json:"-"`
+	// Quarantined links show a warning instead of redirecting until an
+	// admin reviews their reports.
+	Quarantined bool `json:"quarantined,omitempty"`
+}
+
+// LinkUpdate lists the fields to change on a link; nil fields are left
+// alone and zero values of the others clear the setting.
+type LinkUpdate struct {
+	URL            *string
+	ExpiresAt      *int64
+	MaxClicks      *int64
+	Notes          *string
+	RedirectStatus *int
+	Passthrough    *bool
+	PasswordHash   *string
+}
+
 type Summary struct {
 	TotalURLs   int64 `json:"total_urls"`
 	TotalClicks int64 `json:"total_clicks"`
 }
+
+// TimeBucket counts clicks in [Start, Start+interval).
+type TimeBucket struct {
+	Start  int64 `json:"start"`
+	Clicks int64 `json:"clicks"`
+}
+
+type LinkTimeseries struct {
+	Code     string       `json:"code"`
+	Interval string       `json:"interval"`
+	From     int64        `json:"from"`
+	To       int64        `json:"to"`
+	Buckets  []TimeBucket `json:"buckets"`
+}
+
+// Click describes a single redirect. IP is expected to be anonymized by
+// the caller before it reaches the store.
+type Click struct {
+	At        int64  `json:"at"`
+	Referrer  string `json:"referrer"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+}
+
+// APIKey is a stored credential. Hash is the lookup hash of the key; the
+// plaintext is never persisted.
+type APIKey struct {
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	Prefix    string   `json:"prefix"`
+	Hash      string   `json:"-"`
+	Scopes    []string `json:"scopes"`
+	CreatedAt int64    `json:"created_at"`
+	RevokedAt int64    `json:"revoked_at,omitempty"`
+}
+
+// CreateOptions customizes a new short link. The zero value produces a
+// random code that is shared with any other plain link to the same URL.
+type CreateOptions struct {
+	Alias string
+	// ExpiresAt is a unix timestamp after which the link stops resolving;
+	// zero means never.
+	ExpiresAt int64
+	// MaxClicks is the number of redirects the link allows; zero means
+	// unlimited.
+	MaxClicks int64
+	// RedirectStatus is the HTTP status used when following the link; zero
+	// means the server default.
+	RedirectStatus int
+	// Passthrough forwards the visitor's query string and any path after
+	// the code to the destination.
+	Passthrough bool
+	// PasswordHash protects the link; see Link.PasswordHash.
+	PasswordHash string
+}
+
+// Custom reports whether the link needs its own row instead of reusing an
+// existing code for the same URL.
+func (o CreateOptions) Custom() bool {
+	return o.Alias != "" || o.ExpiresAt != 0 || o.MaxClicks != 0 || o.RedirectStatus != 0 || o.Passthrough || o.PasswordHash != ""
+}
+
+// Webhook is an endpoint that receives signed event notifications. An empty
+// Events list subscribes to every event. Secret signs the deliveries, so it
+// is stored as given.
+type Webhook struct {
+	ID        int64    `json:"id"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"-"`
+	Events    []string `json:"events"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+// Report is a visitor's complaint about a link. IP is expected to be
+// anonymized by the caller, like Click.IP.
+type Report struct {
+	ID        int64  `json:"id"`
+	Code      string `json:"code"`
+	Reason    string `json:"reason"`
+	Details   string `json:"details,omitempty"`
+	IP        string `json:"ip"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// DeadLetter is a webhook delivery that still failed after every retry.
+type DeadLetter struct {
+	ID        int64           `json:"id"`
+	WebhookID int64           `json:"webhook_id"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	Error     string          `json:"error"`
+	Attempts  int             `json:"attempts"`
+	FailedAt  int64           `json:"failed_at"`
+}
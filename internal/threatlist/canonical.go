@@ -0,0 +1,232 @@
+package threatlist
+
+import (
+	"strings"
+
+	"github.com/StealthBadger747/ShortSlug/internal/urlcheck"
+)
+
+// controlStripper drops the characters canonicalization ignores. It works
+// on bytes, unlike strings.Map, which would replace invalid UTF-8.
+var controlStripper = strings.NewReplacer("\t", "", "\r", "", "\n", "")
+
+// canonicalURL is a URL canonicalized the way the Safe Browsing API
+// describes, split into the parts lookup expressions are built from.
+type canonicalURL struct {
+	host     string
+	path     string
+	query    string
+	hasQuery bool
+	isIP     bool
+}
+
+func (c canonicalURL) String() string {
+	s := "http://" + c.host + c.path
+	if c.hasQuery {
+		s += "?" + c.query
+	}
+	return s
+}
+
+// canonicalize follows the Safe Browsing canonicalization rules. The scheme
+// doesn't take part in matching, so it is dropped along with any userinfo
+// and port.
+func canonicalize(raw string) (canonicalURL, bool) {
+	raw = controlStripper.Replace(raw)
+	raw = strings.TrimSpace(raw)
+	raw, _, _ = strings.Cut(raw, "#")
+	for {
+		unescaped := unescape(raw)
+		if unescaped == raw {
+			break
+		}
+		raw = unescaped
+	}
+
+	if i := strings.Index(raw, "://"); i > 0 && isScheme(raw[:i]) {
+		raw = raw[i+3:]
+	}
+	authority, rest := raw, ""
+	if i := strings.IndexAny(raw, "/?"); i >= 0 {
+		authority, rest = raw[:i], raw[i:]
+	}
+
+	var c canonicalURL
+	c.host, c.isIP = canonicalHost(authority)
+	if c.host == "" {
+		return canonicalURL{}, false
+	}
+	path, query, hasQuery := strings.Cut(rest, "?")
+	c.path = escape(canonicalPath(path))
+	c.query, c.hasQuery = escape(query), hasQuery
+	c.host = escape(c.host)
+	return c, true
+}
+
+func canonicalHost(authority string) (string, bool) {
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		authority = authority[i+1:]
+	}
+	if strings.HasPrefix(authority, "[") {
+		if i := strings.Index(authority, "]"); i >= 0 {
+			return lowerASCII(authority[:i+1]), true
+		}
+	}
+	if i := strings.LastIndex(authority, ":"); i >= 0 {
+		authority = authority[:i]
+	}
+
+	host := lowerASCII(strings.Trim(authority, "."))
+	for strings.Contains(host, "..") {
+		host = strings.ReplaceAll(host, "..", ".")
+	}
+	if addr, ok := urlcheck.ParseHostIP(host); ok && addr.Is4() {
+		return addr.String(), true
+	}
+	return host, false
+}
+
+// canonicalPath resolves "." and ".." segments and collapses runs of
+// slashes.
+func canonicalPath(path string) string {
+	var segments []string
+	trailing := false
+	for seg := range strings.SplitSeq(path, "/") {
+		trailing = false
+		switch seg {
+		case "":
+			trailing = true
+		case ".":
+			trailing = true
+		case "..":
+			trailing = true
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+		default:
+			segments = append(segments, seg)
+		}
+	}
+	if len(segments) == 0 {
+		return "/"
+	}
+	out := "/" + strings.Join(segments, "/")
+	if trailing {
+		out += "/"
+	}
+	return out
+}
+
+// expressions returns the host suffix and path prefix combinations a list
+// entry can match: the exact host and up to four suffixes of its last five
+// labels, each with the exact path, with and without the query, and up to
+// four leading directories.
+func (c canonicalURL) expressions() []string {
+	hosts := []string{c.host}
+	if !c.isIP {
+		labels := strings.Split(c.host, ".")
+		for i := max(len(labels)-5, 1); i < len(labels)-1; i++ {
+			hosts = append(hosts, strings.Join(labels[i:], "."))
+		}
+	}
+
+	var paths []string
+	if c.hasQuery {
+		paths = append(paths, c.path+"?"+c.query)
+	}
+	paths = append(paths, c.path)
+	prefix := "/"
+	dirs := strings.Split(strings.Trim(c.path, "/"), "/")
+	if !strings.HasSuffix(c.path, "/") {
+		dirs = dirs[:len(dirs)-1]
+	}
+	for i := 0; i < 4; i++ {
+		if prefix != c.path {
+			paths = append(paths, prefix)
+		}
+		if i >= len(dirs) || dirs[i] == "" {
+			break
+		}
+		prefix += dirs[i] + "/"
+	}
+
+	out := make([]string, 0, len(hosts)*len(paths))
+	for _, h := range hosts {
+		for _, p := range paths {
+			out = append(out, h+p)
+		}
+	}
+	return out
+}
+
+func isScheme(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			return false
+		}
+	}
+	return true
+}
+
+// unescape decodes one level of percent escapes, leaving malformed ones.
+func unescape(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// escape percent-encodes control characters, spaces, non-ASCII bytes, "#"
+// and "%".
+func escape(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || c == '#' || c == '%' {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// lowerASCII lowercases without touching other bytes; strings.ToLower
+// would replace invalid UTF-8.
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,258 @@
+// Package threatlist matches URLs against locally stored threat lists, so
+// destinations can be screened without querying a lookup service on every
+// request.
+//
+// Lists hold SHA-256 hash prefixes of Safe Browsing URL expressions. They
+// are read from files in one of three formats, chosen by extension:
+//
+//   - .json: a saved Safe Browsing Update API v4 threatListUpdates:fetch
+//     response holding full updates with RAW compression.
+//   - .csv: a feed such as URLhaus's CSV export; the first field of each
+//     row that looks like an http(s) URL is used.
+//   - anything else: one URL per line, with # comment lines.
+//
+// URLs from feeds are canonicalized and stored as full hashes, so they
+// match exactly the URL listed. A hash prefix only says a URL may be
+// listed; without a full-hash lookup, short prefixes can match innocent
+// URLs, so Match reports them as PossiblyListed.
+package threatlist
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	minPrefixSize = 4
+	maxPrefixSize = sha256.Size
+)
+
+// Verdict is the outcome of matching a URL.
+type Verdict int
+
+const (
+	// NotListed means no entry matched.
+	NotListed Verdict = iota
+	// PossiblyListed means only a hash prefix shorter than a full hash
+	// matched, which innocent URLs can do too.
+	PossiblyListed
+	// Listed means a full hash matched.
+	Listed
+)
+
+// List is a set of threat lists loaded from files. It is safe for
+// concurrent use; Reload swaps in the new contents atomically.
+type List struct {
+	paths []string
+	db    atomic.Pointer[database]
+}
+
+type database struct {
+	// prefixes maps a prefix length to the set of prefixes of that length.
+	prefixes map[int]map[string]struct{}
+	sizes    []int
+	count    int
+}
+
+// Load reads the lists at paths.
+func Load(paths ...string) (*List, error) {
+	l := &List{paths: paths}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload rereads every file. On error the previously loaded lists stay in
+// use.
+func (l *List) Reload() error {
+	db := &database{prefixes: make(map[int]map[string]struct{})}
+	for _, path := range l.paths {
+		if err := db.loadFile(path); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for size := range db.prefixes {
+		db.sizes = append(db.sizes, size)
+	}
+	slices.Sort(db.sizes)
+	l.db.Store(db)
+	return nil
+}
+
+// Len returns the number of hash prefixes loaded.
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return l.db.Load().count
+}
+
+// Match reports whether rawURL, or any host suffix or path prefix of it,
+// is listed, returning the strongest match found.
+func (l *List) Match(rawURL string) Verdict {
+	if l == nil {
+		return NotListed
+	}
+	db := l.db.Load()
+	if db.count == 0 {
+		return NotListed
+	}
+	c, ok := canonicalize(rawURL)
+	if !ok {
+		return NotListed
+	}
+	verdict := NotListed
+	for _, expr := range c.expressions() {
+		sum := sha256.Sum256([]byte(expr))
+		for _, size := range db.sizes {
+			if _, ok := db.prefixes[size][string(sum[:size])]; !ok {
+				continue
+			}
+			if size == maxPrefixSize {
+				return Listed
+			}
+			verdict = PossiblyListed
+		}
+	}
+	return verdict
+}
+
+func (db *database) add(prefix []byte) {
+	set, ok := db.prefixes[len(prefix)]
+	if !ok {
+		set = make(map[string]struct{})
+		db.prefixes[len(prefix)] = set
+	}
+	if _, ok := set[string(prefix)]; !ok {
+		set[string(prefix)] = struct{}{}
+		db.count++
+	}
+}
+
+// addURL lists a URL by the full hash of its most specific expression.
+func (db *database) addURL(raw string) {
+	c, ok := canonicalize(raw)
+	if !ok {
+		return
+	}
+	sum := sha256.Sum256([]byte(c.expressions()[0]))
+	db.add(sum[:])
+}
+
+func (db *database) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return db.loadUpdateResponse(f)
+	case ".csv":
+		return db.loadCSV(f)
+	default:
+		return db.loadURLs(f)
+	}
+}
+
+// fetchResponse is the part of a threatListUpdates:fetch response needed
+// to apply full updates.
+type fetchResponse struct {
+	ListUpdateResponses []struct {
+		ThreatType   string `json:"threatType"`
+		ResponseType string `json:"responseType"`
+		Additions    []struct {
+			CompressionType string `json:"compressionType"`
+			RawHashes       *struct {
+				PrefixSize int    `json:"prefixSize"`
+				RawHashes  string `json:"rawHashes"`
+			} `json:"rawHashes"`
+		} `json:"additions"`
+		Removals []json.RawMessage `json:"removals"`
+	} `json:"listUpdateResponses"`
+}
+
+func (db *database) loadUpdateResponse(r io.Reader) error {
+	var resp fetchResponse
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return err
+	}
+	for _, list := range resp.ListUpdateResponses {
+		// A partial update's removals refer to indices in a list we don't
+		// have, so only self-contained updates can be applied.
+		if list.ResponseType != "FULL_UPDATE" && len(list.Removals) > 0 {
+			return fmt.Errorf("%s: partial updates with removals aren't supported; save a full update", list.ThreatType)
+		}
+		for _, add := range list.Additions {
+			if add.RawHashes == nil {
+				return fmt.Errorf("%s: unsupported compression %q; request RAW", list.ThreatType, add.CompressionType)
+			}
+			size := add.RawHashes.PrefixSize
+			if size < minPrefixSize || size > maxPrefixSize {
+				return fmt.Errorf("%s: invalid prefix size %d", list.ThreatType, size)
+			}
+			raw, err := base64.StdEncoding.DecodeString(add.RawHashes.RawHashes)
+			if err != nil {
+				return fmt.Errorf("%s: %w", list.ThreatType, err)
+			}
+			if len(raw)%size != 0 {
+				return fmt.Errorf("%s: hashes aren't a multiple of the prefix size", list.ThreatType)
+			}
+			for i := 0; i < len(raw); i += size {
+				db.add(raw[i : i+size])
+			}
+		}
+	}
+	return nil
+}
+
+func (db *database) loadCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, field := range record {
+			if isHTTPURL(field) {
+				db.addURL(field)
+				break
+			}
+		}
+	}
+}
+
+func (db *database) loadURLs(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			db.addURL(line)
+		}
+	}
+	return scanner.Err()
+}
+
+func isHTTPURL(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
@@ -0,0 +1,170 @@
+package threatlist
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	// Cases from the Safe Browsing API's canonicalization examples.
+	cases := []struct{ raw, want string }{
+		{"http://host/%25%32%35", "http://host/%25"},
+		{"http://host/%25%32%35%25%32%35", "http://host/%25%25"},
+		{"http://host/%2525252525252525", "http://host/%25"},
+		{"http://host/asdf%25%32%35asd", "http://host/asdf%25asd"},
+		{"http://host/%%%25%32%35asd%%", "http://host/%25%25%25asd%25%25"},
+		{"http://www.google.com/", "http://www.google.com/"},
+		{"http://%31%36%38%2e%31%38%38%2e%39%39%2e%32%36/%2E%73%65%63%75%72%65/%77%77%77%2E%65%62%61%79%2E%63%6F%6D/", "http://168.188.99.26/.secure/www.ebay.com/"},
+		{"http://host%23.com/%257Ea%2521b%2540c%2523d%2524e%25f%255E00%252611%252A22%252833%252944_55%252B", "http://host%23.com/~a!b@c%23d$e%25f^00&11*22(33)44_55+"},
+		{"http://3279880203/blah", "http://195.127.0.11/blah"},
+		{"http://www.google.com/blah/..", "http://www.google.com/"},
+		{"www.google.com/", "http://www.google.com/"},
+		{"www.google.com", "http://www.google.com/"},
+		{"http://www.evil.com/blah#frag", "http://www.evil.com/blah"},
+		{"http://www.GOOgle.com/", "http://www.google.com/"},
+		{"http://www.google.com.../", "http://www.google.com/"},
+		{"http://www.google.com/foo\tbar\rbaz\n2", "http://www.google.com/foobarbaz2"},
+		{"http://www.google.com/q?", "http://www.google.com/q?"},
+		{"http://www.google.com/q?r?", "http://www.google.com/q?r?"},
+		{"http://evil.com/foo#bar#baz", "http://evil.com/foo"},
+		{"http://evil.com/foo?bar;", "http://evil.com/foo?bar;"},
+		{"http://\x01\x80.com/", "http://%01%80.com/"},
+		{"http://notrailingslash.com", "http://notrailingslash.com/"},
+		{"http://www.gotaport.com:1234/", "http://www.gotaport.com/"},
+		{"  http://www.google.com/  ", "http://www.google.com/"},
+		{"http:// leadingspace.com/", "http://%20leadingspace.com/"},
+		{"%20leadingspace.com/", "http://%20leadingspace.com/"},
+		{"https://www.securesite.com/", "http://www.securesite.com/"},
+		{"http://host.com/ab%23cd", "http://host.com/ab%23cd"},
+		{"http://host.com//twoslashes?more//slashes", "http://host.com/twoslashes?more//slashes"},
+	}
+	for _, tc := range cases {
+		c, ok := canonicalize(tc.raw)
+		if !ok {
+			t.Fatalf("%q: failed to canonicalize", tc.raw)
+		}
+		if got := c.String(); got != tc.want {
+			t.Fatalf("%q: expected %q, got %q", tc.raw, tc.want, got)
+		}
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want []string
+	}{
+		{"http://a.b.c/1/2.html?param=1", []string{
+			"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+			"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+		}},
+		{"http://a.b.c.d.e.f.g/1.html", []string{
+			"a.b.c.d.e.f.g/1.html", "a.b.c.d.e.f.g/",
+			"c.d.e.f.g/1.html", "c.d.e.f.g/",
+			"d.e.f.g/1.html", "d.e.f.g/",
+			"e.f.g/1.html", "e.f.g/",
+			"f.g/1.html", "f.g/",
+		}},
+		{"http://1.2.3.4/1/", []string{"1.2.3.4/1/", "1.2.3.4/"}},
+		{"http://a.b/saw-cgi/eBayISAPI.dll/", []string{
+			"a.b/saw-cgi/eBayISAPI.dll/", "a.b/", "a.b/saw-cgi/",
+		}},
+	}
+	for _, tc := range cases {
+		c, _ := canonicalize(tc.raw)
+		if got := c.expressions(); !slices.Equal(got, tc.want) {
+			t.Fatalf("%s: expected %q, got %q", tc.raw, tc.want, got)
+		}
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+
+	whole := sha256.Sum256([]byte("malware.example/"))
+	update := write("malware.json", `{"listUpdateResponses":[{"threatType":"MALWARE","responseType":"FULL_UPDATE","additions":[{"compressionType":"RAW","rawHashes":{"prefixSize":4,"rawHashes":"`+
+		base64.StdEncoding.EncodeToString(whole[:4])+`"}}]}]}`)
+	urlhaus := write("urlhaus.csv", `################################################################
+# abuse.ch URLhaus Database Dump (CSV)                         #
+# id,dateadded,url,url_status,last_online,threat,tags,urlhaus_link,reporter
+"1","2024-05-01 10:00:00","http://198.51.100.7/bins/x86","online","2024-05-01 10:00:00","malware_download","elf","https://urlhaus.abuse.ch/url/1/","someone"
+`)
+	feed := write("phish.txt", "# phishing feed\nhttps://login.phish.example/account/verify?id=1\n")
+
+	l, err := Load(update, urlhaus, feed)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if l.Len() != 3 {
+		t.Fatalf("expected 3 entries, got %d", l.Len())
+	}
+
+	cases := []struct {
+		raw  string
+		want Verdict
+	}{
+		{"https://malware.example/", PossiblyListed},
+		{"http://cdn.MALWARE.example/payload.exe", PossiblyListed},
+		{"https://malware.example.org/", NotListed},
+		{"http://198.51.100.7/bins/x86", Listed},
+		{"http://198.51.100.7/bins/arm", NotListed},
+		{"https://login.phish.example/account/verify?id=1", Listed},
+		{"https://login.phish.example/account/verify?id=2", NotListed},
+		{"https://example.com/", NotListed},
+	}
+	for _, tc := range cases {
+		if got := l.Match(tc.raw); got != tc.want {
+			t.Fatalf("%s: expected %v, got %v", tc.raw, tc.want, got)
+		}
+	}
+}
+
+func TestReloadKeepsListsOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.txt")
+	if err := os.WriteFile(path, []byte("http://bad.example/\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	l, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if l.Match("http://bad.example/") != Listed {
+		t.Fatalf("expected a match")
+	}
+
+	if err := os.WriteFile(path, []byte("http://worse.example/\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := l.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if l.Match("http://bad.example/") != NotListed || l.Match("http://worse.example/") != Listed {
+		t.Fatalf("expected the reloaded list to replace the old one")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := l.Reload(); err == nil {
+		t.Fatalf("expected reloading a missing file to fail")
+	}
+	if l.Match("http://worse.example/") != Listed {
+		t.Fatalf("expected a failed reload to keep the old list")
+	}
+
+	var none *List
+	if none.Match("http://worse.example/") != NotListed || none.Len() != 0 {
+		t.Fatalf("expected a nil list to match nothing")
+	}
+}
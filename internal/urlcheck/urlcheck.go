@@ -0,0 +1,274 @@
+// Package urlcheck decides whether a destination may be shortened. It
+// rejects links into private networks, links back to the shortener itself
+// and domains an operator has blocked.
+package urlcheck
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const resolveTimeout = 2 * time.Second
+
+// The messages are shown to whoever submitted the link.
+var (
+	ErrCredentials = errors.New("Links with a username or password in them aren't allowed.")
+	ErrPrivateHost = errors.New("Links to local or private network addresses aren't allowed.")
+	ErrSelfLink    = errors.New("That URL is already a short link here.")
+	ErrDenied      = errors.New("Links to that domain aren't allowed.")
+	ErrNotAllowed  = errors.New("Only links to approved domains can be shortened here.")
+)
+
+// localSuffixes are names that only resolve inside a local network.
+var localSuffixes = []string{"localhost", "local", "internal", "home.arpa"}
+
+// reservedPrefixes are non-public ranges netip.Addr's predicates miss.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// Resolver looks up a hostname's addresses. *net.Resolver implements it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// Checker validates destinations. The zero value rejects private hosts and
+// has empty domain lists.
+type Checker struct {
+	allowPrivate bool
+	allow        []string
+	deny         []string
+	resolver     Resolver
+}
+
+type Option func(*Checker)
+
+// AllowPrivateHosts accepts local and private network destinations, for
+// deployments that only serve an internal network.
+func AllowPrivateHosts() Option {
+	return func(c *Checker) {
+		c.allowPrivate = true
+	}
+}
+
+// WithResolver resolves hostnames and rejects those with any private
+// address, so names like 127.0.0.1.nip.io can't reach the local network.
+// Names that don't resolve are accepted. The check only happens when a link
+// is saved; DNS can still change afterwards.
+func WithResolver(r Resolver) Option {
+	return func(c *Checker) {
+		c.resolver = r
+	}
+}
+
+// WithDenyList rejects the given domains and their subdomains.
+func WithDenyList(domains []string) Option {
+	return func(c *Checker) {
+		c.deny = normalizeDomains(domains)
+	}
+}
+
+// WithAllowList accepts only the given domains and their subdomains. The
+// deny list still applies within them.
+func WithAllowList(domains []string) Option {
+	return func(c *Checker) {
+		c.allow = normalizeDomains(domains)
+	}
+}
+
+func New(opts ...Option) *Checker {
+	c := &Checker{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Check returns one of the package's errors when u may not be shortened.
+// self lists the shortener's own hosts, so links to them can't create
+// loops.
+func (c *Checker) Check(ctx context.Context, u *url.URL, self ...string) error {
+	if u.User != nil {
+		return ErrCredentials
+	}
+	host := normalizeHost(u.Hostname())
+
+	for _, s := range self {
+		if s = normalizeHost(hostOnly(s)); s != "" && host == s {
+			return ErrSelfLink
+		}
+	}
+
+	if !c.allowPrivate {
+		if addr, ok := ParseHostIP(host); ok {
+			if !isPublicAddr(addr) {
+				return ErrPrivateHost
+			}
+		} else if isLocalName(host) || c.resolvesPrivate(ctx, host) {
+			return ErrPrivateHost
+		}
+	}
+
+	if len(c.allow) > 0 && !matchesDomain(host, c.allow) {
+		return ErrNotAllowed
+	}
+	if matchesDomain(host, c.deny) {
+		return ErrDenied
+	}
+	return nil
+}
+
+// resolvesPrivate reports whether host has a non-public address. Lookup
+// failures count as public; such a link can't be followed to anything yet.
+func (c *Checker) resolvesPrivate(ctx context.Context, host string) bool {
+	if c.resolver == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	addrs, err := c.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadList reads one domain per line, ignoring blank lines and # comments.
+func LoadList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var domains []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			domains = append(domains, line)
+		}
+	}
+	return domains, scanner.Err()
+}
+
+func normalizeDomains(domains []string) []string {
+	out := make([]string, 0, len(domains))
+	for _, d := range domains {
+		if d = normalizeHost(strings.TrimPrefix(strings.TrimSpace(d), "*.")); d != "" {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func hostOnly(hostport string) string {
+	if u, err := url.Parse("//" + hostport); err == nil {
+		return u.Hostname()
+	}
+	return hostport
+}
+
+func matchesDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalName reports single-label hosts and names under suffixes that
+// never resolve publicly.
+func isLocalName(host string) bool {
+	if !strings.Contains(host, ".") {
+		return true
+	}
+	return matchesDomain(host, localSuffixes)
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseHostIP parses IP literals the way browsers do, including shorthand
+// IPv4 forms such as 2130706433, 0x7f.1 or 0177.0.0.1, so they can't be
+// used to sneak a private address past the check.
+func ParseHostIP(host string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr, true
+	}
+
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+	nums := make([]uint64, len(parts))
+	for i, part := range parts {
+		n, ok := parseIPv4Number(part)
+		if !ok {
+			return netip.Addr{}, false
+		}
+		nums[i] = n
+	}
+
+	// Leading parts are single bytes; the last fills the remaining ones.
+	var v uint64
+	for i, n := range nums[:len(nums)-1] {
+		if n > 255 {
+			return netip.Addr{}, false
+		}
+		v |= n << (8 * (3 - i))
+	}
+	last := nums[len(nums)-1]
+	if last >= 1<<(8*(5-len(nums))) {
+		return netip.Addr{}, false
+	}
+	v |= last
+	return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}), true
+}
+
+func parseIPv4Number(s string) (uint64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	base := 10
+	if len(s) > 1 && (s[:2] == "0x" || s[:2] == "0X") {
+		s, base = s[2:], 16
+		if s == "" {
+			return 0, true
+		}
+	} else if len(s) > 1 && s[0] == '0' {
+		s, base = s[1:], 8
+	}
+	n, err := strconv.ParseUint(s, base, 32)
+	return n, err == nil
+}
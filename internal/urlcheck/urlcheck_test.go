@@ -0,0 +1,141 @@
+package urlcheck
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	c := New(
+		WithDenyList([]string{"phish.example", "*.bad.example"}),
+	)
+	cases := []struct {
+		raw  string
+		want error
+	}{
+		{raw: "https://example.com/path", want: nil},
+		{raw: "https://93.184.216.34/", want: nil},
+		{raw: "https://[2606:4700::1111]/", want: nil},
+		{raw: "http://127.0.0.1/admin", want: ErrPrivateHost},
+		{raw: "http://localhost:8080/", want: ErrPrivateHost},
+		{raw: "http://app.localhost/", want: ErrPrivateHost},
+		{raw: "http://printer.local/", want: ErrPrivateHost},
+		{raw: "http://intranet/", want: ErrPrivateHost},
+		{raw: "http://10.1.2.3/", want: ErrPrivateHost},
+		{raw: "http://192.168.1.1/", want: ErrPrivateHost},
+		{raw: "http://169.254.169.254/latest/meta-data", want: ErrPrivateHost},
+		{raw: "http://100.64.0.1/", want: ErrPrivateHost},
+		{raw: "http://0.0.0.0/", want: ErrPrivateHost},
+		{raw: "http://[::1]/", want: ErrPrivateHost},
+		{raw: "http://[fd00::1]/", want: ErrPrivateHost},
+		{raw: "http://[fe80::1]/", want: ErrPrivateHost},
+		{raw: "http://[::ffff:127.0.0.1]/", want: ErrPrivateHost},
+		{raw: "http://2130706433/", want: ErrPrivateHost},
+		{raw: "http://0x7f.1/", want: ErrPrivateHost},
+		{raw: "http://0177.0.0.1/", want: ErrPrivateHost},
+		{raw: "http://127.1/", want: ErrPrivateHost},
+		{raw: "http://LOCALHOST./", want: ErrPrivateHost},
+		{raw: "https://paypal.com@phish.example/", want: ErrCredentials},
+		{raw: "https://sho.rt/abc123", want: ErrSelfLink},
+		{raw: "https://SHO.RT:443/abc123", want: ErrSelfLink},
+		{raw: "https://phish.example/login", want: ErrDenied},
+		{raw: "https://www.phish.example/login", want: ErrDenied},
+		{raw: "https://x.bad.example/", want: ErrDenied},
+		{raw: "https://notphish.example/", want: nil},
+	}
+	for _, tc := range cases {
+		u, err := url.Parse(tc.raw)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tc.raw, err)
+		}
+		if got := c.Check(t.Context(), u, "sho.rt"); !errors.Is(got, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.raw, tc.want, got)
+		}
+	}
+}
+
+func TestCheckAllowListAndPrivateHosts(t *testing.T) {
+	c := New(
+		AllowPrivateHosts(),
+		WithAllowList([]string{"corp.example", "10.0.0.5"}),
+		WithDenyList([]string{"hr.corp.example"}),
+	)
+	cases := []struct {
+		raw  string
+		want error
+	}{
+		{raw: "https://wiki.corp.example/", want: nil},
+		{raw: "http://10.0.0.5/dashboard", want: nil},
+		{raw: "https://hr.corp.example/", want: ErrDenied},
+		{raw: "https://example.com/", want: ErrNotAllowed},
+		{raw: "http://10.0.0.6/", want: ErrNotAllowed},
+		{raw: "http://localhost:8080/", want: ErrSelfLink},
+	}
+	for _, tc := range cases {
+		u, err := url.Parse(tc.raw)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tc.raw, err)
+		}
+		if got := c.Check(t.Context(), u, "localhost:8080"); !errors.Is(got, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.raw, tc.want, got)
+		}
+	}
+}
+
+type fakeResolver map[string][]netip.Addr
+
+func (f fakeResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	addrs, ok := f[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func TestCheckResolvesHosts(t *testing.T) {
+	c := New(WithResolver(fakeResolver{
+		"127.0.0.1.nip.io": {netip.MustParseAddr("127.0.0.1")},
+		"mixed.example":    {netip.MustParseAddr("93.184.216.34"), netip.MustParseAddr("10.0.0.1")},
+		"mapped.example":   {netip.MustParseAddr("::ffff:192.168.1.1")},
+		"public.example":   {netip.MustParseAddr("93.184.216.34")},
+	}))
+	cases := []struct {
+		raw  string
+		want error
+	}{
+		{raw: "http://127.0.0.1.nip.io/", want: ErrPrivateHost},
+		{raw: "https://mixed.example/", want: ErrPrivateHost},
+		{raw: "https://mapped.example/", want: ErrPrivateHost},
+		{raw: "https://public.example/", want: nil},
+		{raw: "https://unresolved.example/", want: nil},
+	}
+	for _, tc := range cases {
+		u, err := url.Parse(tc.raw)
+		if err != nil {
+			t.Fatalf("parse %s: %v", tc.raw, err)
+		}
+		if got := c.Check(t.Context(), u); !errors.Is(got, tc.want) {
+			t.Fatalf("%s: expected %v, got %v", tc.raw, tc.want, got)
+		}
+	}
+}
+
+func TestLoadList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	content := "# phishing reported 2024-05\nphish.example\n\n  *.bad.example  # whole zone\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write list: %v", err)
+	}
+	domains, err := LoadList(path)
+	if err != nil {
+		t.Fatalf("load list: %v", err)
+	}
+	if len(domains) != 2 || domains[0] != "phish.example" || domains[1] != "*.bad.example" {
+		t.Fatalf("unexpected domains: %q", domains)
+	}
+}
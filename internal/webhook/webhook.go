@@ -0,0 +1,371 @@
+// Package webhook delivers signed event notifications to registered
+// endpoints. Deliveries happen in the background on a fixed pool of workers,
+// with retries; events that still fail, or that arrive while the workers are
+// backed up, are written to the store's dead-letter table.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/util"
+)
+
+const (
+	EventLinkCreated  = "link.created"
+	EventLinkClicked  = "link.clicked"
+	EventLinkReported = "link.reported"
+)
+
+// ValidEvent reports whether name is an event endpoints can subscribe to.
+func ValidEvent(name string) bool {
+	return name == EventLinkCreated || name == EventLinkClicked || name == EventLinkReported
+}
+
+const (
+	queueSize       = 1024
+	workers         = 16
+	endpointsMaxAge = 30 * time.Second
+)
+
+var (
+	errShutdown  = errors.New("dispatcher shut down before delivery succeeded")
+	errQueueFull = errors.New("delivery queue full")
+)
+
+// Store is the part of store.Store the dispatcher needs.
+type Store interface {
+	ListWebhooks(ctx context.Context) ([]store.Webhook, error)
+	RecordDeadLetter(ctx context.Context, letter store.DeadLetter) error
+}
+
+// Event is the JSON body POSTed to endpoints.
+type Event struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	CreatedAt int64  `json:"created_at"`
+	Data      any    `json:"data"`
+}
+
+// LinkCreated is the data of a link.created event.
+type LinkCreated struct {
+	Code     string `json:"code"`
+	URL      string `json:"url"`
+	ShortURL string `json:"short_url"`
+}
+
+// LinkClicked is the data of a link.clicked event. Clicks is the link's
+// total after this visit.
+type LinkClicked struct {
+	Code   string      `json:"code"`
+	URL    string      `json:"url"`
+	Clicks int64       `json:"clicks"`
+	Click  store.Click `json:"click"`
+}
+
+// LinkReported is the data of a link.reported event. Reporters counts the
+// distinct addresses that have reported the link.
+type LinkReported struct {
+	Code        string       `json:"code"`
+	URL         string       `json:"url"`
+	Report      store.Report `json:"report"`
+	Reporters   int64        `json:"reporters"`
+	Quarantined bool         `json:"quarantined"`
+}
+
+type Dispatcher struct {
+	store   Store
+	client  *http.Client
+	backoff []time.Duration
+
+	queue      chan Event
+	deliveries chan delivery
+	stop       chan struct{}
+	wg         sync.WaitGroup
+
+	closeMu sync.RWMutex
+	closed  bool
+
+	hooksMu  sync.Mutex
+	hooks    []store.Webhook
+	loadedAt time.Time
+}
+
+type Option func(*Dispatcher)
+
+// WithHTTPClient replaces the client used for deliveries, which otherwise
+// times out after 10 seconds.
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// WithBackoff sets the delays between attempts; a delivery is tried
+// len(delays)+1 times before it is dead-lettered.
+func WithBackoff(delays ...time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.backoff = delays
+	}
+}
+
+// New starts a dispatcher. Close it to flush queued events on shutdown.
+func New(s Store, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		store:      s,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		backoff:    []time.Duration{time.Second, 10 * time.Second, time.Minute},
+		queue:      make(chan Event, queueSize),
+		deliveries: make(chan delivery, queueSize),
+		stop:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.wg.Add(1 + workers)
+	go d.run()
+	for range workers {
+		go d.work()
+	}
+	return d
+}
+
+// Emit queues an event for every endpoint subscribed to eventType. It never
+// waits for the queue: when it is full, the event is dead-lettered for each
+// subscribed endpoint on the caller's goroutine instead. Events emitted
+// after Close are dropped. A nil dispatcher ignores events.
+func (d *Dispatcher) Emit(eventType string, data any) {
+	if d == nil {
+		return
+	}
+	id, err := util.RandomCode(16)
+	if err != nil {
+		return
+	}
+	event := Event{ID: id, Type: eventType, CreatedAt: time.Now().Unix(), Data: data}
+
+	d.closeMu.RLock()
+	defer d.closeMu.RUnlock()
+	if d.closed {
+		return
+	}
+	select {
+	case d.queue <- event:
+	default:
+		slog.Warn("webhook queue full, dead-lettering event", "event", eventType)
+		hooks, body, ok := d.prepare(event)
+		if !ok {
+			return
+		}
+		for _, hook := range hooks {
+			d.deadLetter(hook, event, body, 0, errQueueFull)
+		}
+	}
+}
+
+// Invalidate makes the next event reload endpoints from the store, so
+// changes made through the API apply immediately on this instance.
+func (d *Dispatcher) Invalidate() {
+	if d == nil {
+		return
+	}
+	d.hooksMu.Lock()
+	d.loadedAt = time.Time{}
+	d.hooksMu.Unlock()
+}
+
+// Close stops accepting events and waits for queued ones to be attempted.
+// Deliveries waiting to retry are dead-lettered instead of retried.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.closeMu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+		close(d.stop)
+	}
+	d.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sign returns the X-ShortSlug-Signature value for body: the hex HMAC-SHA256
+// of the body keyed with the endpoint's secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// delivery is one event bound for one endpoint.
+type delivery struct {
+	hook  store.Webhook
+	event Event
+	body  []byte
+}
+
+// run fans events out to the workers. When they fall behind and the
+// delivery queue fills, deliveries are dead-lettered rather than queued
+// without bound, so they can still be replayed.
+func (d *Dispatcher) run() {
+	defer d.wg.Done()
+	defer close(d.deliveries)
+	for event := range d.queue {
+		hooks, body, ok := d.prepare(event)
+		if !ok {
+			continue
+		}
+		for _, hook := range hooks {
+			select {
+			case d.deliveries <- delivery{hook: hook, event: event, body: body}:
+			default:
+				d.deadLetter(hook, event, body, 0, errQueueFull)
+			}
+		}
+	}
+}
+
+// prepare encodes event and returns the endpoints subscribed to it. It logs
+// and reports false if either step fails.
+func (d *Dispatcher) prepare(event Event) ([]store.Webhook, []byte, bool) {
+	hooks, err := d.endpoints()
+	if err != nil {
+		slog.Error("failed to load webhook endpoints", "error", err)
+		return nil, nil, false
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to encode webhook event", "event", event.Type, "error", err)
+		return nil, nil, false
+	}
+	var subscribers []store.Webhook
+	for _, hook := range hooks {
+		if subscribed(hook, event.Type) {
+			subscribers = append(subscribers, hook)
+		}
+	}
+	return subscribers, body, true
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for dl := range d.deliveries {
+		d.deliver(dl.hook, dl.event, dl.body)
+	}
+}
+
+func (d *Dispatcher) endpoints() ([]store.Webhook, error) {
+	d.hooksMu.Lock()
+	defer d.hooksMu.Unlock()
+
+	if !d.loadedAt.IsZero() && time.Since(d.loadedAt) < endpointsMaxAge {
+		return d.hooks, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hooks, err := d.store.ListWebhooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.hooks, d.loadedAt = hooks, time.Now()
+	return hooks, nil
+}
+
+func subscribed(hook store.Webhook, eventType string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, e := range hook.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver tries a delivery until it succeeds or runs out of attempts,
+// holding its worker while it waits to retry.
+func (d *Dispatcher) deliver(hook store.Webhook, event Event, body []byte) {
+	var (
+		err      error
+		attempts int
+	)
+	for attempts <= len(d.backoff) {
+		if attempts > 0 {
+			select {
+			case <-time.After(d.backoff[attempts-1]):
+			case <-d.stop:
+				err = fmt.Errorf("%w (last error: %v)", errShutdown, err)
+				d.deadLetter(hook, event, body, attempts, err)
+				return
+			}
+		}
+		err = d.post(hook, event, body)
+		attempts++
+		if err == nil {
+			return
+		}
+	}
+	d.deadLetter(hook, event, body, attempts, err)
+}
+
+func (d *Dispatcher) post(hook store.Webhook, event Event, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ShortSlug-Webhook")
+	req.Header.Set("X-ShortSlug-Event", event.Type)
+	req.Header.Set("X-ShortSlug-Delivery", event.ID)
+	req.Header.Set("X-ShortSlug-Signature", Sign(hook.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("endpoint returned status " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
+
+func (d *Dispatcher) deadLetter(hook store.Webhook, event Event, body []byte, attempts int, cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := d.store.RecordDeadLetter(ctx, store.DeadLetter{
+		WebhookID: hook.ID,
+		Event:     event.Type,
+		Payload:   body,
+		Error:     cause.Error(),
+		Attempts:  attempts,
+	})
+	if err != nil {
+		slog.Error("failed to record webhook dead letter", "webhook", hook.ID, "event", event.Type, "error", err)
+	}
+}
@@ -0,0 +1,192 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/StealthBadger747/ShortSlug/internal/store"
+	"github.com/StealthBadger747/ShortSlug/internal/store/memory"
+)
+
+func TestDeliverySigned(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	t.Cleanup(endpoint.Close)
+
+	s := memory.New()
+	if _, err := s.CreateWebhook(t.Context(), store.Webhook{URL: endpoint.URL, Secret: "s3cret", Events: []string{EventLinkCreated}}); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	d := New(s)
+	d.Emit(EventLinkClicked, LinkClicked{Code: "ignored"})
+	d.Emit(EventLinkCreated, LinkCreated{Code: "abc123", URL: "https://example.com", ShortURL: "https://sho.rt/abc123"})
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		if got, want := r.Header.Get("X-ShortSlug-Signature"), Sign("s3cret", body); got != want {
+			t.Fatalf("expected signature %q, got %q", want, got)
+		}
+		var event struct {
+			Type string      `json:"type"`
+			Data LinkCreated `json:"data"`
+		}
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		if event.Type != EventLinkCreated || event.Data.Code != "abc123" || r.Header.Get("X-ShortSlug-Event") != EventLinkCreated {
+			t.Fatalf("unexpected event: %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for delivery")
+	}
+
+	if err := d.Close(t.Context()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	select {
+	case <-received:
+		t.Fatalf("expected unsubscribed event not to be delivered")
+	default:
+	}
+}
+
+func TestRetriesThenDeadLetter(t *testing.T) {
+	var calls atomic.Int32
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(endpoint.Close)
+
+	s := memory.New()
+	id, err := s.CreateWebhook(t.Context(), store.Webhook{URL: endpoint.URL, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	d := New(s, WithBackoff(time.Millisecond, time.Millisecond))
+	d.Emit(EventLinkClicked, LinkClicked{Code: "abc123", Clicks: 1})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		letters, err := s.ListDeadLetters(t.Context(), 10)
+		if err != nil {
+			t.Fatalf("list dead letters: %v", err)
+		}
+		if len(letters) == 1 {
+			if letters[0].WebhookID != id || letters[0].Attempts != 3 || letters[0].Event != EventLinkClicked {
+				t.Fatalf("unexpected dead letter: %+v", letters[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for dead letter")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+	if err := d.Close(t.Context()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestCloseDeadLettersPendingRetries(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(endpoint.Close)
+
+	s := memory.New()
+	if _, err := s.CreateWebhook(t.Context(), store.Webhook{URL: endpoint.URL, Secret: "s3cret"}); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	d := New(s, WithBackoff(time.Hour))
+	d.Emit(EventLinkCreated, LinkCreated{Code: "abc123"})
+
+	if err := d.Close(t.Context()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	letters, err := s.ListDeadLetters(t.Context(), 10)
+	if err != nil || len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Fatalf("expected the pending retry to be dead-lettered: %+v %v", letters, err)
+	}
+
+	d.Emit(EventLinkCreated, LinkCreated{Code: "after-close"})
+}
+
+func TestFullQueueDeadLetters(t *testing.T) {
+	release := make(chan struct{})
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(endpoint.Close)
+
+	s := memory.New()
+	if _, err := s.CreateWebhook(t.Context(), store.Webhook{URL: endpoint.URL, Secret: "s3cret"}); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	d := New(s)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for range queueSize {
+			d.Emit(EventLinkClicked, LinkClicked{Code: "abc123"})
+		}
+		letters, err := s.ListDeadLetters(t.Context(), 1)
+		if err != nil {
+			t.Fatalf("list dead letters: %v", err)
+		}
+		if len(letters) == 1 {
+			if letters[0].Error != errQueueFull.Error() || letters[0].Attempts != 0 {
+				t.Fatalf("unexpected dead letter: %+v", letters[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the delivery queue to overflow")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	if err := d.Close(t.Context()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestFullEventQueueDeadLetters(t *testing.T) {
+	s := memory.New()
+	if _, err := s.CreateWebhook(t.Context(), store.Webhook{URL: "https://hooks.example/", Secret: "s3cret", Events: []string{EventLinkClicked}}); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	if _, err := s.CreateWebhook(t.Context(), store.Webhook{URL: "https://other.example/", Secret: "s3cret", Events: []string{EventLinkCreated}}); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	// Nothing reads the unbuffered queue, so every event overflows it.
+	d := &Dispatcher{store: s, queue: make(chan Event)}
+	d.Emit(EventLinkClicked, LinkClicked{Code: "abc123"})
+
+	letters, err := s.ListDeadLetters(t.Context(), 10)
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("expected one dead letter for the subscribed endpoint: %+v %v", letters, err)
+	}
+	if letters[0].Event != EventLinkClicked || letters[0].Error != errQueueFull.Error() || letters[0].Attempts != 0 {
+		t.Fatalf("unexpected dead letter: %+v", letters[0])
+	}
+}
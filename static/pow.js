@@ -0,0 +1,107 @@
+// Solves the proof-of-work challenge from /api/challenge before htmx submits
+// the shorten form. SHA-256 is implemented here because crypto.subtle is
+// only available over HTTPS.
+(() => {
+  const K = new Uint32Array([
+    0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+    0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+    0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+    0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+    0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+    0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+    0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+    0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+  ]);
+  const H0 = new Uint32Array([
+    0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+  ]);
+  const w = new Uint32Array(64);
+  const ror = (x, n) => (x >>> n) | (x << (32 - n));
+
+  function sha256(msg) {
+    const padded = new Uint8Array(((msg.length + 72) >> 6) << 6);
+    padded.set(msg);
+    padded[msg.length] = 0x80;
+    const view = new DataView(padded.buffer);
+    view.setUint32(padded.length - 4, msg.length * 8);
+
+    const h = H0.slice();
+    for (let off = 0; off < padded.length; off += 64) {
+      for (let i = 0; i < 16; i++) {
+        w[i] = view.getUint32(off + i * 4);
+      }
+      for (let i = 16; i < 64; i++) {
+        const s0 = ror(w[i - 15], 7) ^ ror(w[i - 15], 18) ^ (w[i - 15] >>> 3);
+        const s1 = ror(w[i - 2], 17) ^ ror(w[i - 2], 19) ^ (w[i - 2] >>> 10);
+        w[i] = w[i - 16] + s0 + w[i - 7] + s1;
+      }
+      let [a, b, c, d, e, f, g, hh] = h;
+      for (let i = 0; i < 64; i++) {
+        const t1 = (hh + (ror(e, 6) ^ ror(e, 11) ^ ror(e, 25)) + ((e & f) ^ (~e & g)) + K[i] + w[i]) | 0;
+        const t2 = ((ror(a, 2) ^ ror(a, 13) ^ ror(a, 22)) + ((a & b) ^ (a & c) ^ (b & c))) | 0;
+        hh = g;
+        g = f;
+        f = e;
+        e = (d + t1) | 0;
+        d = c;
+        c = b;
+        b = a;
+        a = (t1 + t2) | 0;
+      }
+      h[0] += a;
+      h[1] += b;
+      h[2] += c;
+      h[3] += d;
+      h[4] += e;
+      h[5] += f;
+      h[6] += g;
+      h[7] += hh;
+    }
+    return h;
+  }
+
+  function leadingZeroBits(h) {
+    let bits = 0;
+    for (const word of h) {
+      if (word !== 0) {
+        return bits + Math.clz32(word);
+      }
+      bits += 32;
+    }
+    return bits;
+  }
+
+  async function solve(challenge, difficulty) {
+    const encoder = new TextEncoder();
+    const prefix = challenge + ":";
+    for (let counter = 0; ; counter++) {
+      const token = prefix + counter;
+      if (leadingZeroBits(sha256(encoder.encode(token))) >= difficulty) {
+        return token;
+      }
+      // Yield now and then so the page stays responsive.
+      if (counter % 4096 === 4095) {
+        await new Promise((resolve) => setTimeout(resolve, 0));
+      }
+    }
+  }
+
+  document.addEventListener("htmx:confirm", (event) => {
+    const field = event.target.querySelector("input[data-pow-challenge]");
+    if (!field) {
+      return;
+    }
+    event.preventDefault();
+    fetch(field.dataset.powChallenge, { cache: "no-store" })
+      .then((resp) => resp.json())
+      .then((c) => solve(c.challenge, c.difficulty))
+      .then((token) => {
+        field.value = token;
+      })
+      .catch(() => {
+        // Submit anyway; the server explains the failure.
+        field.value = "";
+      })
+      .finally(() => event.detail.issueRequest(true));
+  });
+})();
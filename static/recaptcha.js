@@ -0,0 +1,17 @@
+// Fetches a reCAPTCHA v3 token right before htmx submits the shorten form,
+// since tokens expire two minutes after they are issued.
+document.addEventListener("htmx:confirm", (event) => {
+  const field = event.target.querySelector("input[data-recaptcha-site-key]");
+  if (!field || typeof grecaptcha === "undefined") {
+    return;
+  }
+  event.preventDefault();
+  grecaptcha.ready(() => {
+    grecaptcha
+      .execute(field.dataset.recaptchaSiteKey, { action: "shorten" })
+      .then((token) => {
+        field.value = token;
+        event.detail.issueRequest(true);
+      });
+  });
+});